@@ -20,6 +20,8 @@ var Servers = []Server{
 	{Src, "1662", "super", "none", "UE4", "Release-4.20", "./p4/2"},
 	{Dst, "1663", "super", "none", "test", "engine", "./p4/3"},
 	{Dst, "1664", "super", "none", "test", "engine", "./p4/4"},
+	{Src, "1665", "super", "none", "UE4", "Release-4.20", "./p4/5"},
+	{Dst, "1666", "super", "none", "test", "engine", "./p4/6"},
 }
 
 func main() {
@@ -52,9 +54,11 @@ func mainExit() int {
 
 	chErr := make(chan error)
 
-	go func() { chErr <- runTwoServers(log, 1663, Servers[0], Servers[2], 3, 1) }()
-	go func() { chErr <- runTwoServers(log, 1664, Servers[1], Servers[3], 3, 2) }()
+	go func() { chErr <- runTwoServers(log, 1663, Servers[0], Servers[2], false, 1) }()
+	go func() { chErr <- runTwoServers(log, 1664, Servers[1], Servers[3], false, 2) }()
+	go func() { chErr <- runTwoServers(log, 1666, Servers[4], Servers[5], true, 1) }()
 
+	<-chErr
 	<-chErr
 	<-chErr
 
@@ -143,7 +147,7 @@ func bringUpServers(logParent frog.Logger, Servers []Server) {
 	wg.Wait()
 }
 
-func writeConfig(file string, src Server, dst Server) error {
+func writeConfig(file string, src Server, dst Server, submitCaseFixes bool) error {
 	var cfg config.Config
 	cfg.Src.P4Port = src.Port()
 	cfg.Src.P4User = src.User()
@@ -153,11 +157,12 @@ func writeConfig(file string, src Server, dst Server) error {
 	cfg.Dst.ClientName = dst.Client()
 	cfg.Dst.ClientRoot = dst.Root()
 	cfg.Dst.ClientStream = dst.StreamPath()
+	cfg.Dst.SubmitCaseFixes = config.Bool(submitCaseFixes)
 
 	return cfg.WriteToFile(file)
 }
 
-func runTwoServers(log frog.Logger, configSuffix int, src, dst Server, cl int64, expectedRuns int) error {
+func runTwoServers(log frog.Logger, configSuffix int, src, dst Server, submitCaseFixes bool, expectedRuns int) error {
 	log = frog.WithFields(log, frog.String("stage", "test"), frog.String("src", src.Port()), frog.String("dst", dst.Port()))
 	l := frog.AddAnchor(log)
 	defer frog.RemoveAnchor(l)
@@ -182,7 +187,7 @@ func runTwoServers(log frog.Logger, configSuffix int, src, dst Server, cl int64,
 
 		// write p4harmonize config and run
 		cfgName := fmt.Sprintf("longtest_%d.toml", configSuffix)
-		if err := writeConfig(cfgName, src, dst); err != nil {
+		if err := writeConfig(cfgName, src, dst, submitCaseFixes); err != nil {
 			return fmt.Errorf("write config: %w", err)
 		}
 		if err := sh.Cmdf(`./%s -config %s`, p4harmonize, cfgName).RunErr(); err != nil {
@@ -193,10 +198,16 @@ func runTwoServers(log frog.Logger, configSuffix int, src, dst Server, cl int64,
 		p4dst := p4.New(sh, dst.Port(), dst.User(), dst.Charset(), dst.Client())
 
 		// submit p4harmonize's changes
-		if err := p4dst.SubmitChangelist(cl); err != nil {
-			return fmt.Errorf("submit cl %d: %w", cl, err)
+		pending, err := p4dst.PendingChangelists()
+		if err != nil {
+			return err
+		}
+		if len(pending) != 1 {
+			return fmt.Errorf("expected 1 pending changelist, found %d", len(pending))
+		}
+		if _, err := p4dst.SubmitChangelist(pending[0]); err != nil {
+			return fmt.Errorf("submit cl %d: %w", pending[0], err)
 		}
-		cl += 1
 
 		srcFiles, dstFiles, err := buildDepotFilesLists(p4src, p4dst)
 		if err != nil {
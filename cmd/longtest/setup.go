@@ -70,7 +70,7 @@ func setupSrc(sh *bsh.Bsh, pf *p4.P4, src Server) error {
 		}
 	}
 
-	if err := pf.SubmitChangelist(cl); err != nil {
+	if _, err := pf.SubmitChangelist(cl); err != nil {
 		return err
 	}
 
@@ -123,7 +123,7 @@ func setupDst(sh *bsh.Bsh, pf *p4.P4, dst Server) error {
 		}
 	}
 
-	if err := pf.SubmitChangelist(cl); err != nil {
+	if _, err := pf.SubmitChangelist(cl); err != nil {
 		return err
 	}
 
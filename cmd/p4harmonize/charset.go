@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// utf8BOM is the byte order mark written at the start of files in the "utf8-bom" charset.
+const utf8BOM = "\xef\xbb\xbf"
+
+// winansiHigh maps the bytes 0x80 to 0x9f in the "winansi" charset (Windows code page 1252) to the runes they
+// represent. Bytes that code page 1252 leaves undefined map to the rune with the same value, as Windows does.
+// Every other byte is the rune with the same value, as in "iso8859-1".
+var winansiHigh = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// CanTranscode returns true if Transcode supports converting between the given perforce charsets.
+func CanTranscode(from, to string) bool {
+	return from == to || (isTranscodable(from) && isTranscodable(to))
+}
+
+func isTranscodable(charset string) bool {
+	switch charset {
+	case "utf8", "utf8-bom", "iso8859-1", "winansi":
+		return true
+	}
+	return false
+}
+
+// Transcode converts content from one perforce charset (as in P4CHARSET) to another. Only "utf8",
+// "utf8-bom", "iso8859-1", and "winansi" are supported. Returns an error if content isn't valid in
+// the from charset, or has characters that the to charset can't represent.
+func Transcode(content []byte, from, to string) ([]byte, error) {
+	if from == to {
+		return content, nil
+	}
+	if !CanTranscode(from, to) {
+		return nil, fmt.Errorf("converting from charset '%s' to '%s' is not supported", from, to)
+	}
+
+	var text string
+	switch from {
+	case "utf8", "utf8-bom":
+		if !utf8.Valid(content) {
+			return nil, fmt.Errorf("content is not valid utf8")
+		}
+		text = strings.TrimPrefix(string(content), utf8BOM)
+	case "iso8859-1", "winansi":
+		var sb strings.Builder
+		sb.Grow(len(content))
+		for _, b := range content {
+			if from == "winansi" && b >= 0x80 && b <= 0x9f {
+				sb.WriteRune(winansiHigh[b-0x80])
+			} else {
+				sb.WriteRune(rune(b))
+			}
+		}
+		text = sb.String()
+	}
+
+	switch to {
+	case "utf8":
+		return []byte(text), nil
+	case "utf8-bom":
+		return []byte(utf8BOM + text), nil
+	}
+
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		b, ok := encodeSingleByte(r, to)
+		if !ok {
+			return nil, fmt.Errorf("character %q can't be represented in charset '%s'", r, to)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// encodeSingleByte returns the byte for r in the "iso8859-1" or "winansi" charset.
+func encodeSingleByte(r rune, charset string) (byte, bool) {
+	if charset == "winansi" {
+		for i, high := range winansiHigh {
+			if r == high {
+				return byte(0x80 + i), true
+			}
+		}
+		if r >= 0x80 && r <= 0x9f {
+			return 0, false
+		}
+	}
+	if r > 0xff {
+		return 0, false
+	}
+	return byte(r), true
+}
+
+// unicodeCharset returns the charset that files of type unicode have in the root of p's client: the
+// client's charset if the server is in unicode mode, or an empty string if it isn't, in which case
+// their content is never converted.
+func unicodeCharset(p *p4.P4) (string, error) {
+	info, err := p.Info()
+	if err != nil {
+		return "", err
+	}
+	if !info.Unicode {
+		return "", nil
+	}
+	return p.Charset, nil
+}
+
+// checkUnicodeFiles looks for files of type unicode that can't be copied from the source to the destination
+// as they are, given whether each server is in unicode mode and the charset of each. Problems that will stop
+// the files from being submitted are logged as errors, and false is returned. Problems that might not are
+// logged as warnings.
+func checkUnicodeFiles(log Logger, cfg config.Config, srcUnicode, dstUnicode bool, files []p4.DepotFile) bool {
+	var unicodeFiles []string
+	for _, f := range files {
+		if isUnicodeType(f.Type) {
+			unicodeFiles = append(unicodeFiles, f.Path)
+		}
+	}
+	if len(unicodeFiles) == 0 {
+		return true
+	}
+
+	switch {
+	case !dstUnicode:
+		log.Error("The destination server is not in unicode mode, so it can't store files of type unicode, including: %s", unicodeFiles[0])
+		log.Error("Please add a type_map to change the type of these %d file(s), ie from 'unicode' to 'text' or 'utf8'.", len(unicodeFiles))
+		return false
+	case !srcUnicode:
+		log.Warning("The source server is not in unicode mode, so the content of its %d unicode file(s) can't be translated to the destination's charset '%s'.",
+			len(unicodeFiles), cfg.Dst.P4Charset)
+		log.Warning("These files will be copied as-is, so the destination server will reject any whose content isn't valid '%s'.",
+			cfg.Dst.P4Charset)
+	case !CanTranscode(cfg.Src.P4Charset, cfg.Dst.P4Charset):
+		log.Error("Unicode files can't be converted from the source charset '%s' to the destination charset '%s', including: %s",
+			cfg.Src.P4Charset, cfg.Dst.P4Charset, unicodeFiles[0])
+		log.Error("Please use the same p4charset for both, or one of: utf8, utf8-bom, iso8859-1, winansi.")
+		return false
+	}
+	return true
+}
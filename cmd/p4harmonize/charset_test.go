@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_Transcode(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Content  string
+		From, To string
+		Expected string
+		Fails    bool
+	}{
+		{"same charset", "caf\xe9", "iso8859-1", "iso8859-1", "caf\xe9", false},
+		{"latin1 to utf8", "caf\xe9", "iso8859-1", "utf8", "café", false},
+		{"utf8 to latin1", "café", "utf8", "iso8859-1", "caf\xe9", false},
+		{"winansi to utf8", "\x80 \x93quoted\x94", "winansi", "utf8", "€ “quoted”", false},
+		{"utf8 to winansi", "€ “quoted”", "utf8", "winansi", "\x80 \x93quoted\x94", false},
+		{"winansi undefined byte", "\x81", "winansi", "utf8", "\u0081", false},
+		{"utf8 to utf8-bom", "abc", "utf8", "utf8-bom", "\xef\xbb\xbfabc", false},
+		{"utf8-bom to utf8", "\xef\xbb\xbfabc", "utf8-bom", "utf8", "abc", false},
+		{"invalid utf8", "caf\xe9", "utf8", "iso8859-1", "", true},
+		{"not representable", "日本", "utf8", "winansi", "", true},
+		{"euro not in latin1", "€", "utf8", "iso8859-1", "", true},
+		{"unsupported charset", "abc", "shiftjis", "utf8", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := Transcode([]byte(tc.Content), tc.From, tc.To)
+			if tc.Fails {
+				if err == nil {
+					t.Errorf("expected an error, got %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if string(actual) != tc.Expected {
+				t.Errorf("expected %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func Test_PerforceFileCopyCharsets(t *testing.T) {
+	settings := CopySettings{SrcCharset: "utf8", DstCharset: "winansi", SrcLineEnding: "\n", DstLineEnding: "\r\n"}
+
+	cases := []struct {
+		Type     string
+		Expected string
+	}{
+		{"unicode", "caf\xe9\r\n"},
+		{"text", "café\r\n"},
+		{"binary", "café\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Type, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src", "file")
+			dst := filepath.Join(dir, "dst", "file")
+			writeFile(t, src, "café\n")
+
+			if err := PerforceFileCopy(src, dst, tc.Type, settings); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if actual := readFile(t, dst); actual != tc.Expected {
+				t.Errorf("expected %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+}
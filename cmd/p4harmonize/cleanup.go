@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// RunCleanup deletes the destination client and client root left behind by a finished run, for each config.
+func RunCleanup(log Logger, cfgs []config.Config, parallel bool) error {
+	return RunMappings(log, cfgs, parallel, func(log Logger, _ int, cfg config.Config) error {
+		return cleanup(log, cfg)
+	})
+}
+
+// cleanup reverts any files left open in shelved changelists, deletes any empty changelists, then
+// deletes the destination client and client root. It refuses to do anything if there is an unfinished
+// run, or if any files are open that are not shelved, since those changes would be lost.
+func cleanup(log Logger, cfg config.Config) error {
+	if _, err := os.Stat(JournalPath(cfg)); err == nil {
+		log.Error("Found journal '%s' from a run that did not finish.", JournalPath(cfg))
+		log.Error("Please run again with --resume to finish it, or delete the journal, then try again.")
+		return fmt.Errorf("cleanup refused")
+	}
+
+	logDst := log.Dst()
+	shDst := MakeLoggingBsh(logDst)
+	p4dst := p4.New(shDst, cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, "")
+
+	if !checkLogin(logDst, p4dst) {
+		return fmt.Errorf("pre-flight checks failed")
+	}
+
+	exists, err := hasClient(p4dst, cfg.Dst.ClientName)
+	if err != nil {
+		logDst.Error("Failed to get clients from %s: %v", cfg.Dst.P4Port, err)
+		return fmt.Errorf("error cleaning up")
+	}
+
+	if exists {
+		p4dst.Client = cfg.Dst.ClientName
+		if err := cleanupClient(logDst, p4dst); err != nil {
+			return err
+		}
+	} else {
+		logDst.Info("Client %s does not exist on %s.", cfg.Dst.ClientName, cfg.Dst.P4Port)
+	}
+
+	root, err := filepath.Abs(cfg.Dst.ClientRoot)
+	if err != nil {
+		logDst.Error("Unable to get absolute path for '%s': %v", cfg.Dst.ClientRoot, err)
+		return fmt.Errorf("error cleaning up")
+	}
+	if shDst.Exists(root) {
+		logDst.Info("Deleting local folder %s...", root)
+		if err := os.RemoveAll(root); err != nil {
+			logDst.Error("Unable to delete '%s': %v", root, err)
+			return fmt.Errorf("error cleaning up")
+		}
+	}
+
+	log.Warning("Cleanup complete.")
+	return nil
+}
+
+// cleanupClient deletes p4dst's client, after making sure nothing would be lost by doing so.
+func cleanupClient(log Logger, p4dst *p4.P4) error {
+	pending, err := p4dst.PendingChangelists()
+	if err != nil {
+		log.Error("%v", err)
+		return fmt.Errorf("error cleaning up")
+	}
+	shelved, err := p4dst.ShelvedChangelists()
+	if err != nil {
+		log.Error("%v", err)
+		return fmt.Errorf("error cleaning up")
+	}
+	isShelved := make(map[int64]bool, len(shelved))
+	for _, cl := range shelved {
+		isShelved[cl] = true
+	}
+
+	// count the open files in each changelist, and make sure every open file is in a shelved changelist
+	allOpened, err := p4dst.Opened()
+	if err != nil {
+		log.Error("%v", err)
+		return fmt.Errorf("error cleaning up")
+	}
+	openedByCL := make(map[int64]int, len(pending))
+	unshelved := len(allOpened)
+	for _, cl := range pending {
+		opened, err := p4dst.Opened(p4.Changelist(cl))
+		if err != nil {
+			log.Error("%v", err)
+			return fmt.Errorf("error cleaning up")
+		}
+		openedByCL[cl] = len(opened)
+		if isShelved[cl] {
+			unshelved -= len(opened)
+		} else if len(opened) > 0 {
+			log.Error("Changelist %d still has %d open file(s). Please submit or shelve it, then try again.", cl, len(opened))
+		}
+	}
+	if unshelved > 0 {
+		log.Error("Client %s has %d open file(s) that have not been submitted or shelved.", p4dst.Client, unshelved)
+		return fmt.Errorf("cleanup refused")
+	}
+
+	for _, cl := range pending {
+		switch {
+		case isShelved[cl] && openedByCL[cl] > 0:
+			log.Info("Reverting %d file(s) in changelist %d, keeping the shelved files...", openedByCL[cl], cl)
+			if err := p4dst.Revert(fmt.Sprintf("//%s/...", p4dst.Client), p4.Changelist(cl), p4.Keep); err != nil {
+				log.Error("Unable to revert files in changelist %d: %v", cl, err)
+				return fmt.Errorf("error cleaning up")
+			}
+		case !isShelved[cl]:
+			log.Info("Deleting empty changelist %d...", cl)
+			if err := p4dst.DeleteChangelist(cl); err != nil {
+				log.Error("Unable to delete changelist %d: %v", cl, err)
+				return fmt.Errorf("error cleaning up")
+			}
+		}
+	}
+
+	var opts []p4.Option
+	if len(shelved) > 0 {
+		log.Info("Shelved changelist(s) %v will be kept.", shelved)
+		opts = append(opts, p4.KeepShelves)
+	}
+	log.Info("Deleting client %s...", p4dst.Client)
+	if err := p4dst.DeleteClient(p4dst.Client, opts...); err != nil {
+		log.Error("%v", err)
+		return fmt.Errorf("error cleaning up")
+	}
+	return nil
+}
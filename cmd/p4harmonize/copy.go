@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// CopySettings holds the settings for copying files from the source client's root to the destination's.
+type CopySettings struct {
+	Strategy      string // see copyFile
+	SrcLineEnding string // line ending of text files in the source client's root, ie "\r\n" (see LineEnding)
+	DstLineEnding string // line ending text files should have in the destination client's root
+	SrcCharset    string // charset of unicode files in the source client's root (see unicodeCharset)
+	DstCharset    string // charset unicode files should have in the destination client's root
+}
+
+// strategyFor returns the strategy for copying a file of the given type. A hardlinked file is the same file as
+// the source, so any change to the mode or modification time of the copy would change the source too. Files
+// whose type makes applyTypeModifiers change either are cloned or copied instead (see withoutHardlinks).
+func (s CopySettings) strategyFor(filetype string) string {
+	if isExecutableType(filetype) || keepsModTime(filetype) {
+		return s.withoutHardlinks().Strategy
+	}
+	return s.Strategy
+}
+
+// withoutHardlinks returns these settings, but with config.CopyStrategyHardlink replaced by
+// config.CopyStrategyReflink, for files that will be changed after they're copied (ie opened for edit, which
+// makes them writable).
+func (s CopySettings) withoutHardlinks() CopySettings {
+	if s.Strategy == config.CopyStrategyHardlink {
+		s.Strategy = config.CopyStrategyReflink
+	}
+	return s
+}
+
+// conversionFor returns a function that converts the content of a file of the given type from how it is
+// in the source client's root to how it should be in the destination's, or nil if no conversion is needed.
+// Files whose type perforce converts the line endings of get the destination's line endings, and unicode
+// files are converted to the destination's charset (see Transcode).
+func (s CopySettings) conversionFor(filetype string) (func([]byte) ([]byte, error), error) {
+	eol := s.SrcLineEnding != s.DstLineEnding && translatesLineEndings(filetype)
+	charset := isUnicodeType(filetype) && len(s.SrcCharset) > 0 && len(s.DstCharset) > 0 && s.SrcCharset != s.DstCharset
+
+	if eol {
+		if isUTF16Type(filetype) {
+			return nil, fmt.Errorf("unable to convert line endings of utf16 files from %s to %s; "+
+				"please give the source and destination clients the same LineEnd option",
+				describeLineEnding(s.SrcLineEnding), describeLineEnding(s.DstLineEnding))
+		}
+	}
+	if !eol && !charset {
+		return nil, nil
+	}
+
+	return func(content []byte) ([]byte, error) {
+		if charset {
+			var err error
+			content, err = Transcode(content, s.SrcCharset, s.DstCharset)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if eol {
+			content = ConvertLineEndings(content, s.SrcLineEnding, s.DstLineEnding)
+		}
+		return content, nil
+	}, nil
+}
+
+// lineEndingOf returns the line ending that text in a copied file of the given type has in the destination
+// client's root: the destination's, if the file's line endings are converted (see conversionFor), or else
+// the source's, since the file is copied as-is.
+func (s CopySettings) lineEndingOf(filetype string) string {
+	if translatesLineEndings(filetype) {
+		return s.DstLineEnding
+	}
+	return s.SrcLineEnding
+}
+
+// PerforceFileCopy copies file "src" to file/path "dst", creating any missing directories needed by "dst",
+// and handling Perforce escape characters (%00) properly. If settings say the file's content needs
+// converting (see CopySettings.conversionFor), then the converted content is written instead. Files are
+// only hardlinked if their type allows it (see CopySettings.strategyFor).
+func PerforceFileCopy(src, dst, filetype string, settings CopySettings) error {
+	srcPath, err := p4.UnescapePath(src)
+	if err != nil {
+		return err
+	}
+	dstPath, err := p4.UnescapePath(dst)
+	if err != nil {
+		return err
+	}
+
+	strategy := settings.strategyFor(filetype)
+
+	if isAppleType(filetype) {
+		srcDouble := filepath.Join(filepath.Dir(srcPath), "%"+filepath.Base(srcPath))
+		dstDouble := filepath.Join(filepath.Dir(dstPath), "%"+filepath.Base(dstPath))
+		if err := verifyAndCopy(srcDouble, dstDouble, strategy, nil); err != nil {
+			return err
+		}
+	}
+
+	convert, err := settings.conversionFor(filetype)
+	if err != nil {
+		return fmt.Errorf("unable to copy '%s': %w", srcPath, err)
+	}
+
+	if err := verifyAndCopy(srcPath, dstPath, strategy, convert); err != nil {
+		return err
+	}
+	return applyTypeModifiers(dstPath, filetype, func() (time.Time, error) {
+		srcInfo, err := os.Stat(srcPath)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to stat '%s': %w", srcPath, err)
+		}
+		return srcInfo.ModTime(), nil
+	})
+}
+
+// applyTypeModifiers updates the file at dstPath the way "p4 sync" would for files of the given type:
+// executable files (+x) get their executable bits set, and files that keep their modification time (+m)
+// get the source's modification time, as returned by modTime (which is only called for +m files).
+// Symlinks are left as-is.
+func applyTypeModifiers(dstPath, filetype string, modTime func() (time.Time, error)) error {
+	dstInfo, err := os.Lstat(dstPath)
+	if err != nil {
+		return fmt.Errorf("unable to stat '%s': %w", dstPath, err)
+	}
+	if dstInfo.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	if isExecutableType(filetype) {
+		if err := makeExecutable(dstPath); err != nil {
+			return err
+		}
+	}
+
+	if keepsModTime(filetype) {
+		t, err := modTime()
+		if err != nil {
+			return err
+		}
+		if err := os.Chtimes(dstPath, t, t); err != nil {
+			return fmt.Errorf("unable to set modification time of '%s': %w", dstPath, err)
+		}
+	}
+	return nil
+}
+
+// verifyAndCopy copies srcPath to dstPath (see copyFile), or if convert isn't nil, writes the converted content of
+// srcPath to dstPath (see convertFile).
+func verifyAndCopy(srcPath, dstPath, strategy string, convert func([]byte) ([]byte, error)) error {
+	srcInfo, err := os.Lstat(srcPath)
+	if err != nil {
+		return fmt.Errorf("unable to stat '%s': %w", srcPath, err)
+	}
+
+	isSymlink := srcInfo.Mode()&os.ModeSymlink != 0
+	if !isSymlink && !srcInfo.Mode().IsRegular() {
+		return fmt.Errorf("'%s' is not a regular file or a symlink", srcPath)
+	}
+	srcSize := srcInfo.Size()
+
+	dstDir := filepath.Dir(dstPath)
+	if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to mkdir '%s': %w", dstDir, err)
+	}
+
+	if isSymlink {
+		return copySymlink(srcPath, dstPath)
+	}
+
+	// the converted file's size will differ from the source's, so there's nothing more to verify
+	if convert != nil {
+		return convertFile(srcPath, dstPath, convert)
+	}
+
+	if err := copyFile(srcPath, dstPath, strategy); err != nil {
+		return err
+	}
+
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		return fmt.Errorf("unable to stat '%s': %w", dstPath, err)
+	}
+	if n := dstInfo.Size(); n != srcSize {
+		return fmt.Errorf("expected '%s' to copy %d bytes to '%s', but only %d were copied", srcPath, srcSize, dstPath, n)
+	}
+	return nil
+}
+
+// copyFile makes dstPath a copy of srcPath. With config.CopyStrategyReflink, it first tries to clone
+// the file, so that both share the same blocks on disk until one is written to. With
+// config.CopyStrategyHardlink, if that fails it then tries a hardlink. Whenever a strategy isn't supported
+// (ie the filesystem can't clone, or the paths are on different volumes), it falls back to copying bytes.
+// Any existing file at dstPath is removed first, so that writing to a file hardlinked by an earlier run
+// can never change the source file. A hardlinked copy shares everything with the source file, including its
+// mode and modification time, so callers must not hardlink files that will be changed in any way after
+// they're copied.
+func copyFile(srcPath, dstPath, strategy string) error {
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove existing '%s': %w", dstPath, err)
+	}
+
+	switch strategy {
+	case config.CopyStrategyReflink, config.CopyStrategyHardlink:
+		if err := reflinkFile(srcPath, dstPath); err == nil {
+			return nil
+		}
+		if strategy == config.CopyStrategyHardlink {
+			if err := os.Link(srcPath, dstPath); err == nil {
+				return nil
+			}
+		}
+	}
+
+	return byteCopyFile(srcPath, dstPath)
+}
+
+// convertFile writes the content of srcPath, after passing it through convert, to a new file at dstPath.
+func convertFile(srcPath, dstPath string, convert func([]byte) ([]byte, error)) error {
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("unable to read '%s': %w", srcPath, err)
+	}
+	content, err = convert(content)
+	if err != nil {
+		return fmt.Errorf("unable to convert '%s': %w", srcPath, err)
+	}
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove existing '%s': %w", dstPath, err)
+	}
+	if err := os.WriteFile(dstPath, content, 0666); err != nil {
+		return fmt.Errorf("unable to write '%s': %w", dstPath, err)
+	}
+	return nil
+}
+
+// byteCopyFile copies the content of srcPath into a new file at dstPath.
+func byteCopyFile(srcPath, dstPath string) error {
+	s, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("unable to open '%s': %w", srcPath, err)
+	}
+	defer s.Close()
+
+	d, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("unable to create '%s': %w", dstPath, err)
+	}
+	defer d.Close()
+
+	if _, err := io.Copy(d, s); err != nil {
+		return fmt.Errorf("unable to copy '%s' to '%s': %w", srcPath, dstPath, err)
+	}
+	return nil
+}
+
+// copySymlink creates dstPath as a symlink with the same target as the symlink at srcPath. The target
+// is copied as-is, without being followed, so relative and dangling links stay that way.
+func copySymlink(srcPath, dstPath string) error {
+	target, err := os.Readlink(srcPath)
+	if err != nil {
+		return fmt.Errorf("unable to read symlink '%s': %w", srcPath, err)
+	}
+	return makeSymlink(target, dstPath)
+}
+
+// makeSymlink replaces any existing file at path with a symlink to target, then checks that the new
+// link's target is exactly target.
+func makeSymlink(target, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove existing '%s': %w", path, err)
+	}
+	if err := os.Symlink(target, path); err != nil {
+		return fmt.Errorf("unable to create symlink '%s': %w", path, err)
+	}
+
+	actual, err := os.Readlink(path)
+	if err != nil {
+		return fmt.Errorf("unable to read symlink '%s': %w", path, err)
+	}
+	if actual != target {
+		return fmt.Errorf("expected symlink '%s' to point to '%s', but it points to '%s'", path, target, actual)
+	}
+	return nil
+}
+
+// makeExecutable sets the executable bits of the file at path (which does nothing on Windows).
+func makeExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to stat '%s': %w", path, err)
+	}
+	if err := os.Chmod(path, info.Mode().Perm()|0111); err != nil {
+		return fmt.Errorf("unable to make '%s' executable: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+)
+
+func Test_PerforceFileCopyStrategies(t *testing.T) {
+	for _, strategy := range []string{"", config.CopyStrategyCopy, config.CopyStrategyReflink, config.CopyStrategyHardlink} {
+		t.Run(strategy, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src", "a%40b.txt")
+			dst := filepath.Join(dir, "dst", "sub", "a%40b.txt")
+			writeFile(t, filepath.Join(dir, "src", "a@b.txt"), "hello")
+
+			if err := PerforceFileCopy(src, dst, "text", CopySettings{Strategy: strategy}); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if actual := readFile(t, filepath.Join(dir, "dst", "sub", "a@b.txt")); actual != "hello" {
+				t.Errorf("expected 'hello', got '%s'", actual)
+			}
+		})
+	}
+}
+
+func Test_CopySettingsStrategyFor(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Strategy string
+		Type     string
+		Expected string
+	}{
+		{"hardlink text", config.CopyStrategyHardlink, "text", config.CopyStrategyHardlink},
+		{"hardlink executable", config.CopyStrategyHardlink, "text+x", config.CopyStrategyReflink},
+		{"hardlink modtime", config.CopyStrategyHardlink, "binary+m", config.CopyStrategyReflink},
+		{"reflink executable", config.CopyStrategyReflink, "text+x", config.CopyStrategyReflink},
+		{"copy modtime", config.CopyStrategyCopy, "binary+m", config.CopyStrategyCopy},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if actual := (CopySettings{Strategy: tc.Strategy}).strategyFor(tc.Type); actual != tc.Expected {
+				t.Errorf("expected '%s', got '%s'", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func Test_PerforceFileCopyDoesNotHardlinkModifiedFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.sh")
+	dst := filepath.Join(dir, "dst.sh")
+	writeFile(t, src, "#!/bin/sh")
+	before, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := PerforceFileCopy(src, dst, "text+x", CopySettings{Strategy: config.CopyStrategyHardlink}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		t.Errorf("expected an executable file not to be hardlinked")
+	}
+	if srcInfo.Mode() != before.Mode() {
+		t.Errorf("expected the source's mode to stay %v, got %v", before.Mode(), srcInfo.Mode())
+	}
+}
+
+func Test_CopyFileBreaksExistingHardlink(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dst := filepath.Join(dir, "dst.txt")
+	writeFile(t, src, "source")
+	if err := os.Link(src, dst); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+
+	other := filepath.Join(dir, "other.txt")
+	writeFile(t, other, "other")
+	if err := copyFile(other, dst, config.CopyStrategyCopy); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if actual := readFile(t, src); actual != "source" {
+		t.Errorf("expected source to be unchanged, got '%s'", actual)
+	}
+	if actual := readFile(t, dst); actual != "other" {
+		t.Errorf("expected 'other', got '%s'", actual)
+	}
+}
+
+func Test_PerforceFileCopySymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks on windows requires extra privileges")
+	}
+
+	cases := []struct {
+		Name   string
+		Target string
+	}{
+		{"relative", "target.txt"},
+		{"relative parent", "../other/target.txt"},
+		{"absolute", "/some/absolute/target.txt"},
+		{"dangling", "missing.txt"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "src", "target.txt"), "target")
+			src := filepath.Join(dir, "src", "link")
+			if err := os.Symlink(tc.Target, src); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			// an existing file should be replaced by the link, not written through
+			dst := filepath.Join(dir, "dst", "link")
+			writeFile(t, dst, "existing")
+
+			if err := PerforceFileCopy(src, dst, "symlink", CopySettings{Strategy: config.CopyStrategyHardlink}); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			info, err := os.Lstat(dst)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if info.Mode()&os.ModeSymlink == 0 {
+				t.Fatalf("expected '%s' to be a symlink, got mode %v", dst, info.Mode())
+			}
+			actual, err := os.Readlink(dst)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if actual != tc.Target {
+				t.Errorf("expected link to '%s', got '%s'", tc.Target, actual)
+			}
+		})
+	}
+}
+
+func Test_PerforceFileCopyTypeModifiers(t *testing.T) {
+	cases := []struct {
+		Type       string
+		Executable bool
+		KeepsTime  bool
+	}{
+		{"text", false, false},
+		{"text+x", true, false},
+		{"xbinary", true, false},
+		{"binary+mx", true, true},
+		{"binary+m", false, true},
+		{"binary+S10", false, false},
+	}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tc := range cases {
+		t.Run(tc.Type, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src", "file")
+			dst := filepath.Join(dir, "dst", "file")
+			writeFile(t, src, "content")
+			if err := os.Chtimes(src, modTime, modTime); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			if err := PerforceFileCopy(src, dst, tc.Type, CopySettings{}); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			info, err := os.Stat(dst)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if runtime.GOOS != "windows" {
+				if executable := info.Mode().Perm()&0111 == 0111; executable != tc.Executable {
+					t.Errorf("expected executable to be %v, got mode %v", tc.Executable, info.Mode())
+				}
+			}
+			if keptTime := info.ModTime().Equal(modTime); keptTime != tc.KeepsTime {
+				t.Errorf("expected modification time kept to be %v, got %v", tc.KeepsTime, info.ModTime())
+			}
+		})
+	}
+}
+
+func Test_ApplyTypeModifiersOnlyGetsModTimeWhenKept(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, filetype := range []string{"text", "binary+m"} {
+		t.Run(filetype, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			writeFile(t, path, "content")
+
+			called := false
+			err := applyTypeModifiers(path, filetype, func() (time.Time, error) {
+				called = true
+				return modTime, nil
+			})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			if called != keepsModTime(filetype) {
+				t.Errorf("expected modTime to be called: %v, got %v", keepsModTime(filetype), called)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if keptTime := info.ModTime().Equal(modTime); keptTime != keepsModTime(filetype) {
+				t.Errorf("expected modification time kept to be %v", keepsModTime(filetype))
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return string(b)
+}
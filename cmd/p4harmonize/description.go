@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/danbrakeley/p4harmonize/internal/buildvar"
+	"github.com/danbrakeley/p4harmonize/internal/config"
+)
+
+// DescriptionData holds the values that a changelist description template can use.
+type DescriptionData struct {
+	Mapping       string          // name of the mapping (empty if there are no mappings)
+	Src           PlanSource      // source server, client, stream, revision, and change
+	Dst           PlanDestination // destination server and stream
+	Summary       DiffSummary     // counts of each kind of change in this changelist
+	Version       string          // version of p4harmonize
+	EngineVersion string          // version from Engine/Build/Build.version in the source, ie "5.3.2" (empty if it couldn't be read)
+	CaseFixChange int64           // change that deleted files with mismatched case (zero if there wasn't one)
+	Part          int             // which changelist this is, starting at 1
+	Parts         int             // how many changelists the changes were split across
+}
+
+// MakeDescription fills in the description template tmpl (or config.DefaultDescription, if tmpl is empty).
+func MakeDescription(tmpl string, data DescriptionData) (string, error) {
+	if len(tmpl) == 0 {
+		tmpl = config.DefaultDescription
+	}
+	t, err := template.New("description").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("error parsing description template: %w", err)
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("error filling in description template: %w", err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// descriptionFor builds the DescriptionData for the i-th of n changelists.
+func descriptionFor(journal *Journal, diff DepotFileDiff, i, n int) DescriptionData {
+	return DescriptionData{
+		Mapping:       journal.Plan.Mapping,
+		Src:           journal.Plan.Src,
+		Dst:           journal.Plan.Dst,
+		Summary:       diff.Summarize(),
+		Version:       buildvar.Version,
+		EngineVersion: journal.Plan.Src.EngineVersion,
+		CaseFixChange: journal.CaseFixChangelist,
+		Part:          i + 1,
+		Parts:         n,
+	}
+}
+
+// EngineVersionPath is where the Unreal Engine version is found, relative to the root of the source stream.
+const EngineVersionPath = "Engine/Build/Build.version"
+
+// usesEngineVersion returns true if the description template needs the Unreal Engine version.
+func usesEngineVersion(tmpl string) bool {
+	return strings.Contains(tmpl, ".EngineVersion")
+}
+
+// ParseEngineVersion parses the contents of an Unreal Engine Build.version file (see EngineVersionPath),
+// and returns the version as "major.minor.patch".
+func ParseEngineVersion(contents []byte) (string, error) {
+	var v struct {
+		MajorVersion int
+		MinorVersion int
+		PatchVersion int
+	}
+	if err := json.Unmarshal(contents, &v); err != nil {
+		return "", fmt.Errorf("error decoding %s: %w", EngineVersionPath, err)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.MajorVersion, v.MinorVersion, v.PatchVersion), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_MakeDescription(t *testing.T) {
+	data := DescriptionData{
+		Src:           PlanSource{P4Port: "ssl:src:1666", Stream: "//UE5/Release-5.3", Change: 1234},
+		Summary:       DiffSummary{Adds: 3, Deletes: 2},
+		EngineVersion: "5.3.2",
+		Part:          1,
+		Parts:         1,
+	}
+
+	var cases = []struct {
+		Name     string
+		Template string
+		Data     func(d DescriptionData) DescriptionData
+		Expected string
+	}{
+		{"default", "", nil, "p4harmonize"},
+		{"default with case fixes", "", func(d DescriptionData) DescriptionData { d.CaseFixChange = 57; return d },
+			"p4harmonize, including re-adding the files deleted in change 57 with the correct case"},
+		{"default with parts", "", func(d DescriptionData) DescriptionData { d.Part, d.Parts = 2, 3; return d },
+			"p4harmonize (part 2 of 3)"},
+		{"custom multi-line with quotes",
+			"Update to \"{{.EngineVersion}}\"\n\nFrom {{.Src.P4Port}} {{.Src.Stream}}@{{.Src.Change}}\n{{.Summary.Adds}} add(s), {{.Summary.Deletes}} delete(s)\n",
+			nil,
+			"Update to \"5.3.2\"\n\nFrom ssl:src:1666 //UE5/Release-5.3@1234\n3 add(s), 2 delete(s)"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			d := data
+			if tc.Data != nil {
+				d = tc.Data(d)
+			}
+			actual, err := MakeDescription(tc.Template, d)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if actual != tc.Expected {
+				t.Errorf("Expected:\n%q\nActual:\n%q", tc.Expected, actual)
+			}
+		})
+	}
+
+	if _, err := MakeDescription("{{.NoSuchField}}", data); err == nil {
+		t.Errorf("expected an error for an unknown field")
+	}
+}
+
+func Test_ParseEngineVersion(t *testing.T) {
+	contents := `{"MajorVersion": 5, "MinorVersion": 3, "PatchVersion": 2, "Changelist": 0, "BranchName": "++UE5+Release-5.3"}`
+	actual, err := ParseEngineVersion([]byte(contents))
+	if err != nil || actual != "5.3.2" {
+		t.Errorf("expected '5.3.2', got '%s', %v", actual, err)
+	}
+
+	if _, err := ParseEngineVersion(nil); err == nil {
+		t.Errorf("expected an error for an empty file")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// VerifyDigest checks that the MD5 of the file at path (which may contain perforce escape characters)
+// matches the digest the source server reported for src. Text files also match if they do once their
+// line endings (lineEnding, ie "\r\n", or CRLF if empty) are converted to LF, the same way as
+// ConvertLineEndings, since the server computes digests with LF line endings.
+// Files whose digest can't be reproduced from the workspace file (see canVerifyDigest), either with the
+// type they were synced with in the source, or with the type they'll have in the destination (src.Type,
+// which a type map may have changed), or that have no digest, are not checked.
+func VerifyDigest(path string, src p4.DepotFile, lineEnding string) error {
+	srcType := depotType(src)
+	if len(src.Digest) == 0 || !canVerifyDigest(srcType) || !canVerifyDigest(src.Type) {
+		return nil
+	}
+
+	localPath, err := p4.UnescapePath(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("unable to open '%s': %w", localPath, err)
+	}
+	defer f.Close()
+
+	raw := md5.New()
+	lf := md5.New()
+	if len(lineEnding) == 0 {
+		lineEnding = "\r\n"
+	}
+	lfw := &toLFWriter{w: lf, eol: lineEnding}
+	if _, err := io.Copy(io.MultiWriter(raw, lfw), f); err != nil {
+		return fmt.Errorf("unable to read '%s': %w", localPath, err)
+	}
+	lfw.Flush()
+
+	rawDigest := hex.EncodeToString(raw.Sum(nil))
+	if strings.EqualFold(rawDigest, src.Digest) {
+		return nil
+	}
+	if (isTextType(srcType) || isTextType(src.Type)) && strings.EqualFold(hex.EncodeToString(lf.Sum(nil)), src.Digest) {
+		return nil
+	}
+	return fmt.Errorf("'%s' has digest %s, but the source file '%s' has digest %s",
+		localPath, strings.ToUpper(rawDigest), src.Path, src.Digest)
+}
+
+// toLFWriter passes everything written to it on to w, except that each eol (which is "\r\n", "\r", or "\n")
+// becomes LF.
+type toLFWriter struct {
+	w         io.Writer
+	eol       string
+	pendingCR bool
+}
+
+func (c *toLFWriter) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+1)
+	for _, b := range p {
+		switch c.eol {
+		case "\r":
+			if b == '\r' {
+				b = '\n'
+			}
+			out = append(out, b)
+		case "\r\n":
+			if c.pendingCR && b != '\n' {
+				out = append(out, '\r')
+			}
+			c.pendingCR = b == '\r'
+			if !c.pendingCR {
+				out = append(out, b)
+			}
+		default:
+			out = append(out, b)
+		}
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any CR that was held back waiting to see if it was followed by LF.
+func (c *toLFWriter) Flush() error {
+	if !c.pendingCR {
+		return nil
+	}
+	c.pendingCR = false
+	_, err := c.w.Write([]byte{'\r'})
+	return err
+}
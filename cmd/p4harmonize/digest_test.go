@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+func Test_VerifyDigest(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Type     string
+		Content  string
+		Digest   string
+		Expected bool
+	}{
+		{"binary match", "binary+l", "a\r\nb", md5Of("a\r\nb"), true},
+		{"binary mismatch", "binary", "a\r\nb", md5Of("a\nb"), false},
+		{"text match", "text", "a\nb\n", md5Of("a\nb\n"), true},
+		{"text with crlf", "text", "a\r\nb\r\n", md5Of("a\nb\n"), true},
+		{"text with lone cr", "xtext", "a\rb\r", md5Of("a\rb\r"), true},
+		{"text mismatch", "text", "a\nc\n", md5Of("a\nb\n"), false},
+		{"lowercase digest", "binary", "x", strings.ToLower(md5Of("x")), true},
+		{"no digest", "binary", "x", "", true},
+		{"keywords skipped", "text+k", "$Id$", md5Of("other"), true},
+		{"ktext skipped", "ktext", "$Id$", md5Of("other"), true},
+		{"utf16 skipped", "utf16", "x", md5Of("other"), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			writeFile(t, path, tc.Content)
+
+			err := VerifyDigest(path, p4.DepotFile{Path: "file", Type: tc.Type, Digest: tc.Digest}, "")
+			if tc.Expected && err != nil {
+				t.Errorf("expected digest to match, got: %v", err)
+			}
+			if !tc.Expected && err == nil {
+				t.Errorf("expected digest mismatch")
+			}
+		})
+	}
+}
+
+func Test_VerifyDigestMappedTypes(t *testing.T) {
+	cases := []struct {
+		Name     string
+		OrigType string
+		Type     string
+		Content  string
+		Digest   string
+		Expected bool
+	}{
+		{"text mapped to binary", "text", "binary", "a\r\nb", md5Of("a\nb"), true},
+		{"binary mapped to text", "binary", "text", "a\r\nb", md5Of("a\nb"), true},
+		{"binary mapped to text mismatch", "binary", "text", "a\nc", md5Of("a\nb"), false},
+		{"keywords mapped away skipped", "text+k", "text", "$Id: //a#1 $", md5Of("$Id$"), true},
+		{"mapped to keywords skipped", "text", "text+k", "$Id$", md5Of("other"), true},
+		{"mapped to utf8 skipped", "text", "utf8", "x", md5Of("other"), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			writeFile(t, path, tc.Content)
+
+			err := VerifyDigest(path, p4.DepotFile{Path: "file", Type: tc.Type, OrigType: tc.OrigType, Digest: tc.Digest}, "")
+			if tc.Expected && err != nil {
+				t.Errorf("expected digest to match, got: %v", err)
+			}
+			if !tc.Expected && err == nil {
+				t.Errorf("expected digest mismatch")
+			}
+		})
+	}
+}
+
+func Test_VerifyDigestLineEndings(t *testing.T) {
+	cases := []struct {
+		Name       string
+		LineEnding string
+		Content    string
+		Expected   bool
+	}{
+		{"unknown with crlf", "", "a\r\nb\r\n", true},
+		{"unix", "\n", "a\nb\n", true},
+		{"win", "\r\n", "a\r\nb\r\n", true},
+		{"mac", "\r", "a\rb\r", true},
+		{"mac with crlf", "\r", "a\r\nb\r\n", false},
+		{"win with cr", "\r\n", "a\rb\r", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			writeFile(t, path, tc.Content)
+
+			err := VerifyDigest(path, p4.DepotFile{Path: "file", Type: "text", Digest: md5Of("a\nb\n")}, tc.LineEnding)
+			if tc.Expected && err != nil {
+				t.Errorf("expected digest to match, got: %v", err)
+			}
+			if !tc.Expected && err == nil {
+				t.Errorf("expected digest mismatch")
+			}
+		})
+	}
+}
+
+func Test_CRLFToLFWriterAcrossWrites(t *testing.T) {
+	var sb strings.Builder
+	w := &toLFWriter{w: &sb, eol: "\r\n"}
+	for _, chunk := range []string{"a\r", "\nb\r", "c\r"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if expected := "a\nb\rc\r"; sb.String() != expected {
+		t.Errorf("expected %q, got %q", expected, sb.String())
+	}
+}
+
+func Test_CRToLFWriter(t *testing.T) {
+	var sb strings.Builder
+	w := &toLFWriter{w: &sb, eol: "\r"}
+	for _, chunk := range []string{"a\r", "b\r\n"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if expected := "a\nb\n\n"; sb.String() != expected {
+		t.Errorf("expected %q, got %q", expected, sb.String())
+	}
+	if actual := string(ConvertLineEndings([]byte("a\rb\r\n"), "\r", "\n")); actual != sb.String() {
+		t.Errorf("expected the same result as ConvertLineEndings (%q), got %q", actual, sb.String())
+	}
+}
+
+// md5Of returns the digest of s the way perforce reports it (uppercase hex).
+func md5Of(s string) string {
+	sum := md5.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
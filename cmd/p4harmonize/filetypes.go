@@ -0,0 +1,75 @@
+package main
+
+import "github.com/danbrakeley/p4harmonize/internal/p4"
+
+// parseType parses a perforce file type (see p4.ParseFileType). Types that can't be parsed are returned
+// as a FileType with no base type or modifiers, so they aren't treated as any particular kind of file.
+func parseType(filetype string) p4.FileType {
+	ft, err := p4.ParseFileType(filetype)
+	if err != nil {
+		return p4.FileType{}
+	}
+	return ft
+}
+
+// isTextType returns true if filetype's base type is "text", ie "text", "ktext", or "text+l".
+func isTextType(filetype string) bool {
+	return parseType(filetype).Base == "text"
+}
+
+// isAppleType returns true if filetype's base type is "apple".
+func isAppleType(filetype string) bool {
+	return parseType(filetype).Base == "apple"
+}
+
+// isSymlinkType returns true if filetype's base type is "symlink".
+func isSymlinkType(filetype string) bool {
+	return parseType(filetype).Base == "symlink"
+}
+
+// isUnicodeType returns true if filetype's base type is "unicode", which is the only type whose content
+// perforce converts between a client's charset and utf8 (and then only on servers in unicode mode).
+func isUnicodeType(filetype string) bool {
+	return parseType(filetype).Base == "unicode"
+}
+
+// isUTF16Type returns true if filetype's base type is "utf16".
+func isUTF16Type(filetype string) bool {
+	return parseType(filetype).Base == "utf16"
+}
+
+// isExecutableType returns true if files of the given type are executable, either because of the +x
+// modifier, or because the type is one of the older names for executable types, ie "xtext" or "xbinary".
+func isExecutableType(filetype string) bool {
+	return parseType(filetype).Has(p4.ModExecutable)
+}
+
+// keepsModTime returns true if files of the given type keep their original modification time (+m).
+func keepsModTime(filetype string) bool {
+	return parseType(filetype).Has(p4.ModModTime)
+}
+
+// canVerifyDigest returns false for file types whose digest on the server doesn't match the content of
+// the file in a workspace: files with expanded keywords, utf8, utf16, and unicode files (which may be
+// translated to the client's charset), and apple, resource, and symlink files.
+func canVerifyDigest(filetype string) bool {
+	ft := parseType(filetype)
+	if ft.Has(p4.ModKeywords) || ft.Has(p4.ModOldKeywords) {
+		return false
+	}
+	switch ft.Base {
+	case "utf8", "utf16", "unicode", "apple", "resource", "symlink":
+		return false
+	}
+	return true
+}
+
+// translatesLineEndings returns true if perforce converts the line endings of files of the given type
+// when they are synced and submitted.
+func translatesLineEndings(filetype string) bool {
+	switch parseType(filetype).Base {
+	case "text", "unicode", "utf8", "utf16":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// PathFilter decides which files get harmonized, based on a config.Filter.
+type PathFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func NewPathFilter(f config.Filter) *PathFilter {
+	pf := &PathFilter{
+		include: make([]*regexp.Regexp, 0, len(f.Include)),
+		exclude: make([]*regexp.Regexp, 0, len(f.Exclude)),
+	}
+	for _, pattern := range f.Include {
+		pf.include = append(pf.include, p4.WildcardRegexp(pattern))
+	}
+	for _, pattern := range f.Exclude {
+		pf.exclude = append(pf.exclude, p4.WildcardRegexp(pattern))
+	}
+	return pf
+}
+
+// IsEmpty returns true if the filter would keep every file.
+func (f *PathFilter) IsEmpty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+// Keep returns true if the given path (relative to the stream root, and with perforce's escaping
+// of reserved characters) passes the filter.
+func (f *PathFilter) Keep(path string) bool {
+	// patterns are written without perforce's escaping (ie "@", not "%40"), so unescape before matching
+	if unescaped, err := p4.UnescapePath(path); err == nil {
+		path = unescaped
+	}
+
+	if len(f.include) > 0 {
+		included := false
+		for _, re := range f.include {
+			if re.MatchString(path) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, re := range f.exclude {
+		if re.MatchString(path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply returns only the files that pass the filter, in the same order they were passed in.
+func (f *PathFilter) Apply(files []p4.DepotFile) []p4.DepotFile {
+	if f.IsEmpty() {
+		return files
+	}
+
+	out := make([]p4.DepotFile, 0, len(files))
+	for _, file := range files {
+		if f.Keep(file.Path) {
+			out = append(out, file)
+		}
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+)
+
+func Test_PathFilter(t *testing.T) {
+	var cases = []struct {
+		Name     string
+		Include  []string
+		Exclude  []string
+		Files    string
+		Expected string
+	}{
+		{"no filter", nil, nil, "a,b/c", "a,b/c"},
+		{"include only",
+			[]string{"Engine/..."}, nil,
+			"Engine/a,engine/b,Samples/c,Setup.sh", "Engine/a,engine/b",
+		},
+		{"exclude only",
+			nil, []string{"Samples/...", "FeaturePacks/..."},
+			"Engine/a,FeaturePacks/b,Samples/c,Setup.sh", "Engine/a,Setup.sh",
+		},
+		{"include and exclude",
+			[]string{"Engine/..."}, []string{"Engine/Extras/..."},
+			"Engine/a,Engine/Extras/b,Samples/c", "Engine/a",
+		},
+		{"escaped characters",
+			nil, []string{"*@2x.png"},
+			"Icon20%402x.png,Icon20.png", "Icon20.png",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			f := NewPathFilter(config.Filter{Include: tc.Include, Exclude: tc.Exclude})
+			var paths []string
+			for _, file := range f.Apply(makeDepotFilesFromString(tc.Files)) {
+				paths = append(paths, file.Path)
+			}
+			actual := strings.Join(paths, ",")
+			if actual != tc.Expected {
+				t.Errorf("Expected: %s, Actual: %s", tc.Expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+)
+
+// Journal records the plan being applied and each step of applyPlan that has completed, so that
+// a run that fails part way through can be picked up again with --resume.
+type Journal struct {
+	Plan              Plan          `json:"plan"`
+	Split             SplitSettings `json:"split"`
+	CaseFixChangelist int64         `json:"case_fix_changelist,omitempty"`
+	Changelists       []int64       `json:"changelists,omitempty"`
+	Completed         []string      `json:"completed"`
+
+	// path is where the journal is saved after every change
+	path string
+	done map[string]bool
+}
+
+// Names of the steps recorded in the journal. Steps that are repeated for each file type or file
+// have the type or path appended (see StepFor). When the changes are split across more than one
+// changelist, the steps for each changelist are prefixed with its index (see StepForChangelist).
+const (
+	StepClient   = "client"
+	StepSync     = "sync"
+	StepCaseFix  = "casefix"
+	StepDelete   = "delete"
+	StepEdit     = "edit"
+	StepMove     = "move"
+	StepCopy     = "copy"
+	StepRetype   = "retype"
+	StepAdd      = "add"
+	StepRevert   = "revert"
+	StepShelve   = "shelve"
+	stepSplitter = ":"
+)
+
+// StepFor builds the name of a step that is repeated, for example StepFor(StepAdd, "binary+l").
+func StepFor(step, detail string) string {
+	return step + stepSplitter + detail
+}
+
+// StepForChangelist builds the name of a step done for the i-th changelist, for example StepForChangelist(1, StepAdd).
+func StepForChangelist(i int, step string) string {
+	return fmt.Sprintf("%d%s%s", i, stepSplitter, step)
+}
+
+// JournalPath returns where the journal for the passed config is kept, which is next to the config file,
+// and named after the destination client.
+func JournalPath(cfg config.Config) string {
+	return filepath.Join(filepath.Dir(cfg.Filename()), fmt.Sprintf("p4harmonize-%s.journal.json", cfg.Dst.ClientName))
+}
+
+// NewJournal creates a journal for the given plan, split across changelists with the given settings, that
+// will be saved to path. Nothing is written to disk until the first call to Save or Done.
+func NewJournal(path string, plan Plan, split SplitSettings) *Journal {
+	return &Journal{
+		Plan:  plan,
+		Split: split,
+		path:  path,
+		done:  make(map[string]bool),
+	}
+}
+
+func LoadJournalFromFile(path string) (*Journal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	var j Journal
+	if err := json.NewDecoder(f).Decode(&j); err != nil {
+		return nil, fmt.Errorf("error decoding '%s': %w", path, err)
+	}
+
+	j.path = path
+	j.done = make(map[string]bool, len(j.Completed))
+	for _, step := range j.Completed {
+		j.done[step] = true
+	}
+	return &j, nil
+}
+
+// Path returns the location of the journal on disk.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// IsDone returns true if the given step was already completed.
+func (j *Journal) IsDone(step string) bool {
+	return j.done[step]
+}
+
+// Done marks the given step as completed, then saves the journal.
+func (j *Journal) Done(step string) error {
+	if !j.done[step] {
+		j.done[step] = true
+		j.Completed = append(j.Completed, step)
+	}
+	return j.Save()
+}
+
+// ChangelistAt returns the i-th changelist being built, or 0 if it hasn't been created yet.
+func (j *Journal) ChangelistAt(i int) int64 {
+	if i < len(j.Changelists) {
+		return j.Changelists[i]
+	}
+	return 0
+}
+
+// SetChangelistAt records the i-th changelist being built, then saves the journal.
+func (j *Journal) SetChangelistAt(i int, cl int64) error {
+	for len(j.Changelists) <= i {
+		j.Changelists = append(j.Changelists, 0)
+	}
+	j.Changelists[i] = cl
+	return j.Save()
+}
+
+// SetCaseFixChangelist records the changelist that deletes files with mismatched case, then saves the journal.
+func (j *Journal) SetCaseFixChangelist(cl int64) error {
+	j.CaseFixChangelist = cl
+	return j.Save()
+}
+
+// Save writes the journal to disk. The journal is written to a temporary file first, then renamed,
+// so that a crash while saving can't leave behind a partially written journal.
+func (j *Journal) Save() error {
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error opening '%s': %w", tmp, err)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(j); err != nil {
+		f.Close()
+		return fmt.Errorf("error encoding/writing '%s': %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing '%s': %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("error renaming '%s' to '%s': %w", tmp, j.path, err)
+	}
+	return nil
+}
+
+// Remove deletes the journal from disk, if it was ever saved.
+func (j *Journal) Remove() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting '%s': %w", j.path, err)
+	}
+	return nil
+}
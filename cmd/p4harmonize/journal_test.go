@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_JournalRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	plan := Plan{Src: PlanSource{P4Port: "src:1666", Change: 12}}
+
+	split := SplitSettings{MaxFilesPerChangelist: 1000, ChangelistPerDirectory: true}
+
+	j := NewJournal(path, plan, split)
+	if err := j.SetChangelistAt(1, 42); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, step := range []string{StepClient, StepSync, StepForChangelist(1, StepFor(StepAdd, "binary+l")), StepClient} {
+		if err := j.Done(step); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	loaded, err := LoadJournalFromFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if loaded.ChangelistAt(0) != 0 || loaded.ChangelistAt(1) != 42 || loaded.ChangelistAt(2) != 0 {
+		t.Errorf("expected changelists [0 42], got %v", loaded.Changelists)
+	}
+	if loaded.Plan.Src.Change != 12 {
+		t.Errorf("expected plan source change 12, got %d", loaded.Plan.Src.Change)
+	}
+	if loaded.Split != split {
+		t.Errorf("expected split settings %+v, got %+v", split, loaded.Split)
+	}
+	if len(loaded.Completed) != 3 {
+		t.Errorf("expected 3 completed steps, got %v", loaded.Completed)
+	}
+	for _, step := range []string{StepClient, StepSync, StepForChangelist(1, StepFor(StepAdd, "binary+l"))} {
+		if !loaded.IsDone(step) {
+			t.Errorf("expected step '%s' to be done", step)
+		}
+	}
+	if loaded.IsDone(StepDelete) {
+		t.Errorf("expected step '%s' to not be done", StepDelete)
+	}
+	if loaded.IsDone(StepFor(StepAdd, "binary+l")) {
+		t.Errorf("expected step '%s' to not be done", StepFor(StepAdd, "binary+l"))
+	}
+
+	if err := loaded.Remove(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected journal to be removed, got: %v", err)
+	}
+}
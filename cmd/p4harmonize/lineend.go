@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// LineEnding returns the line ending that "p4 sync" writes text files with, for a client with the
+// given LineEnd option, running on the given OS (as in runtime.GOOS).
+func LineEnding(lineEnd, goos string) string {
+	switch lineEnd {
+	case "unix", "share":
+		return "\n"
+	case "mac":
+		return "\r"
+	case "win":
+		return "\r\n"
+	default: // "local"
+		if goos == "windows" {
+			return "\r\n"
+		}
+		return "\n"
+	}
+}
+
+// clientLineEnding returns the line ending of text files in the root of p's client (see LineEnding).
+func clientLineEnding(p *p4.P4, goos string) (string, error) {
+	spec, err := p.GetClientSpec()
+	if err != nil {
+		return "", err
+	}
+	return LineEnding(spec["LineEnd"], goos), nil
+}
+
+// ConvertLineEndings returns content with its line endings changed from one line ending to another, the same
+// way that submitting from a client with the first, and then syncing to a client with the second, would.
+func ConvertLineEndings(content []byte, from, to string) []byte {
+	if from == to {
+		return content
+	}
+	if from != "\n" {
+		content = bytes.ReplaceAll(content, []byte(from), []byte("\n"))
+	}
+	if to != "\n" {
+		content = bytes.ReplaceAll(content, []byte("\n"), []byte(to))
+	}
+	return content
+}
+
+// describeLineEnding returns a readable name for a line ending, ie "CRLF".
+func describeLineEnding(eol string) string {
+	return strings.NewReplacer("\r", "CR", "\n", "LF").Replace(eol)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_LineEnding(t *testing.T) {
+	cases := []struct {
+		LineEnd  string
+		GOOS     string
+		Expected string
+	}{
+		{"local", "windows", "\r\n"},
+		{"local", "linux", "\n"},
+		{"", "darwin", "\n"},
+		{"unix", "windows", "\n"},
+		{"share", "windows", "\n"},
+		{"win", "linux", "\r\n"},
+		{"mac", "linux", "\r"},
+	}
+
+	for _, tc := range cases {
+		if actual := LineEnding(tc.LineEnd, tc.GOOS); actual != tc.Expected {
+			t.Errorf("LineEnding(%q, %q): expected %q, got %q", tc.LineEnd, tc.GOOS, tc.Expected, actual)
+		}
+	}
+}
+
+func Test_ConvertLineEndings(t *testing.T) {
+	cases := []struct {
+		Content  string
+		From, To string
+		Expected string
+	}{
+		{"a\r\nb\r\n", "\r\n", "\n", "a\nb\n"},
+		{"a\nb\n", "\n", "\r\n", "a\r\nb\r\n"},
+		{"a\rb\r", "\r", "\r\n", "a\r\nb\r\n"},
+		{"a\r\nb\n", "\n", "\n", "a\r\nb\n"},
+		// a lone LF in a windows client is submitted as-is, so it becomes a line ending too
+		{"a\r\nb\nc", "\r\n", "\r", "a\rb\rc"},
+	}
+
+	for _, tc := range cases {
+		if actual := string(ConvertLineEndings([]byte(tc.Content), tc.From, tc.To)); actual != tc.Expected {
+			t.Errorf("ConvertLineEndings(%q, %q, %q): expected %q, got %q", tc.Content, tc.From, tc.To, tc.Expected, actual)
+		}
+	}
+}
+
+func Test_PerforceFileCopyLineEndings(t *testing.T) {
+	settings := CopySettings{SrcLineEnding: "\r\n", DstLineEnding: "\n"}
+
+	cases := []struct {
+		Type     string
+		Expected string
+	}{
+		{"text", "a\nb\n"},
+		{"xtext+k", "a\nb\n"},
+		{"utf8", "a\nb\n"},
+		{"binary", "a\r\nb\r\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Type, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src", "file")
+			dst := filepath.Join(dir, "dst", "file")
+			writeFile(t, src, "a\r\nb\r\n")
+
+			if err := PerforceFileCopy(src, dst, tc.Type, settings); err != nil {
+				t.Fatalf("%v", err)
+			}
+			if actual := readFile(t, dst); actual != tc.Expected {
+				t.Errorf("expected %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src", "file")
+	writeFile(t, src, "a\r\n")
+	if err := PerforceFileCopy(src, filepath.Join(dir, "dst", "file"), "utf16", settings); err == nil {
+		t.Errorf("expected utf16 file with different line endings to fail")
+	}
+}
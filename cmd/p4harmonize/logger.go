@@ -13,6 +13,7 @@ import (
 type Logger interface {
 	Src() Logger
 	Dst() Logger
+	Tagged(tag string) Logger
 
 	Info(format string, args ...interface{})
 	Verbose(format string, args ...interface{})
@@ -27,6 +28,7 @@ type Logger interface {
 
 type FrogLog struct {
 	Logger  frog.Logger
+	Tag     string // written before the prefix, to tell apart output from mappings running at the same time
 	Prefix  string
 	Palette frog.Palette
 }
@@ -48,9 +50,20 @@ func MakeLogger(l frog.RootLogger) (log Logger, close func()) {
 	return log, close
 }
 
+// Tagged returns a logger that starts every line with the passed tag (in square brackets).
+func (l *FrogLog) Tagged(tag string) Logger {
+	return &FrogLog{
+		Logger:  l.Logger,
+		Tag:     "[" + tag + "] ",
+		Prefix:  l.Prefix,
+		Palette: l.Palette,
+	}
+}
+
 func (l *FrogLog) Src() Logger {
 	return &FrogLog{
 		Logger: l.Logger,
+		Tag:    l.Tag,
 		Prefix: "  >>- ",
 		Palette: frog.Palette{
 			{frog.DarkGray, frog.DarkBlue}, // Transient
@@ -65,6 +78,7 @@ func (l *FrogLog) Src() Logger {
 func (l *FrogLog) Dst() Logger {
 	return &FrogLog{
 		Logger: l.Logger,
+		Tag:    l.Tag,
 		Prefix: "  --> ",
 		Palette: frog.Palette{
 			{frog.DarkGray, frog.DarkGreen},  // Transient
@@ -79,7 +93,7 @@ func (l *FrogLog) Dst() Logger {
 func (l *FrogLog) logImpl(level frog.Level, format string, args ...interface{}) {
 	l.Logger.LogImpl(
 		level,
-		l.Prefix+fmt.Sprintf(format, args...),
+		l.Tag+l.Prefix+fmt.Sprintf(format, args...),
 		nil,
 		[]frog.PrinterOption{frog.POPalette(l.Palette)},
 		frog.ImplData{},
@@ -88,7 +102,7 @@ func (l *FrogLog) logImpl(level frog.Level, format string, args ...interface{})
 func (l *FrogLog) logImplFast(level frog.Level, msg string) {
 	l.Logger.LogImpl(
 		level,
-		l.Prefix+msg,
+		l.Tag+l.Prefix+msg,
 		nil,
 		[]frog.PrinterOption{frog.POPalette(l.Palette)},
 		frog.ImplData{},
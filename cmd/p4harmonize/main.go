@@ -33,11 +33,26 @@ func PrintUsage() {
 			"%s",
 			"",
 			"Usage:",
-			"\tp4harmonize [--config PATH]",
+			"\tp4harmonize [--config PATH] [--at REV] [--dry-run | --resume] [--shelve]",
+			"\tp4harmonize [--config PATH] [--at REV] plan [--out PATH]",
+			"\tp4harmonize [--config PATH] [--shelve] apply PLAN_PATH",
+			"\tp4harmonize [--config PATH] cleanup",
 			"\tp4harmonize --version",
 			"\tp4harmonize --help",
+			"Commands:",
+			"\t(none)                Build a changelist in the destination that makes it match the source",
+			"\tplan                  Save what would change to a plan file (default: 'plan.json'); only a temporary client is created",
+			"\tapply PLAN_PATH       Build a changelist from a saved plan, if neither server has changed since it was saved",
+			"\tcleanup               Delete the destination client and client root, once the changelist is submitted or shelved",
 			"Options:",
 			"\t-c, --config PATH     Config file location (default: 'config.toml')",
+			"\t-m, --mapping NAME    Only run the [[mapping]] with this name (default: run every mapping)",
+			"\t    --parallel        Run all mappings at the same time, instead of one after another",
+			"\t    --at REV          Harmonize the source at a revision, ie @12345, @label, or @2024/05/01 (overrides source.revision)",
+			"\t    --dry-run         List what would change in the destination, then exit; only a temporary client is created",
+			"\t    --resume          Continue a run that failed part way through, using the journal it left next to the config",
+			"\t    --shelve          Shelve the finished changelist and revert its files, so the client can be deleted right away",
+			"\t    --copy-workers N  How many files to copy at the same time (default: one per CPU)",
 			"\t-v, --version         Print just the version number (to stdout)",
 			"\t-h, --help            Print this message (to stderr)",
 			"",
@@ -64,8 +79,20 @@ func mainExit() int {
 	var cfgPath string
 	var showVersion bool
 	var showHelp bool
+	var opts Options
+	var srcRevision string
+	var mappingName string
+	var parallel bool
 	flag.StringVar(&cfgPath, "c", "config.toml", "config file location")
 	flag.StringVar(&cfgPath, "config", "config.toml", "config file location")
+	flag.StringVar(&mappingName, "m", "", "mapping name")
+	flag.StringVar(&mappingName, "mapping", "", "mapping name")
+	flag.BoolVar(&parallel, "parallel", false, "run mappings in parallel")
+	flag.StringVar(&srcRevision, "at", "", "source revision")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "list changes without making them")
+	flag.BoolVar(&opts.Resume, "resume", false, "continue a failed run")
+	flag.BoolVar(&opts.Shelve, "shelve", false, "shelve the changelist")
+	flag.IntVar(&opts.CopyWorkers, "copy-workers", 0, "how many files to copy at the same time")
 	flag.BoolVar(&showVersion, "v", false, "show version info")
 	flag.BoolVar(&showVersion, "version", false, "show version info")
 	flag.BoolVar(&showHelp, "h", false, "show version info")
@@ -86,8 +113,61 @@ func mainExit() int {
 		return 0
 	}
 
-	if len(flag.Args()) > 0 {
-		fmt.Printf("unrecognized arguments: %v\n", strings.Join(flag.Args(), " "))
+	// everything after the flags is an optional command, followed by that command's own args
+	var command, planPath string
+	args := flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "":
+	case "plan":
+		fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+		fs.Usage = PrintUsage
+		fs.StringVar(&planPath, "out", "plan.json", "plan file location")
+		if err := fs.Parse(args); err != nil {
+			return 1
+		}
+		args = fs.Args()
+	case "cleanup":
+	case "apply":
+		if len(args) > 0 {
+			planPath, args = args[0], args[1:]
+		} else {
+			fmt.Printf("apply requires the path to a plan file\n")
+			flag.Usage()
+			return 1
+		}
+	default:
+		args = flag.Args()
+	}
+
+	if len(args) > 0 {
+		fmt.Printf("unrecognized arguments: %v\n", strings.Join(args, " "))
+		flag.Usage()
+		return 1
+	}
+
+	if opts.DryRun && len(command) > 0 {
+		fmt.Printf("--dry-run cannot be used with the %s command\n", command)
+		flag.Usage()
+		return 1
+	}
+
+	if opts.Shelve && (opts.DryRun || command == "plan" || command == "cleanup") {
+		fmt.Printf("--shelve cannot be combined with --dry-run, or the plan or cleanup commands\n")
+		flag.Usage()
+		return 1
+	}
+
+	if opts.CopyWorkers < 0 {
+		fmt.Printf("--copy-workers cannot be negative\n")
+		flag.Usage()
+		return 1
+	}
+
+	if opts.Resume && (opts.DryRun || len(command) > 0) {
+		fmt.Printf("--resume cannot be combined with --dry-run or a command\n")
 		flag.Usage()
 		return 1
 	}
@@ -108,7 +188,46 @@ func mainExit() int {
 
 	log.Info("Config loaded from %s", cfg.Filename())
 
-	err = Harmonize(log, cfg)
+	if len(srcRevision) > 0 {
+		cfg.Src.Revision = srcRevision
+		for i := range cfg.Mappings {
+			cfg.Mappings[i].Src.Revision = srcRevision
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Error("Invalid config: %v", err)
+		return 1
+	}
+
+	cfgs := cfg.Resolve()
+	if len(mappingName) > 0 {
+		var found bool
+		for _, c := range cfgs {
+			if c.Name() == mappingName {
+				cfgs = []config.Config{c}
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Error("No mapping named '%s' in %s", mappingName, cfg.Filename())
+			return 1
+		}
+	}
+
+	switch command {
+	case "plan":
+		err = RunPlan(log, cfgs, parallel, planPath)
+	case "apply":
+		err = RunApply(log, cfgs, parallel, planPath, opts)
+	case "cleanup":
+		err = RunCleanup(log, cfgs, parallel)
+	default:
+		err = RunMappings(log, cfgs, parallel, func(log Logger, _ int, cfg config.Config) error {
+			return Harmonize(log, cfg, opts)
+		})
+	}
 	if err != nil {
 		log.Error("%v", err)
 		return 2
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+)
+
+// MappingFunc does the work for a single config. i is the config's index in the slice passed to RunMappings.
+type MappingFunc func(log Logger, i int, cfg config.Config) error
+
+type mappingResult struct {
+	Err      error
+	Duration time.Duration
+}
+
+// RunMappings calls fn once for each config, either one after another, or all at the same time if parallel
+// is true. When there is more than one config, each one logs with its mapping's name as a tag, and a summary
+// of how each one went is logged at the end. Returns an error if any call to fn returned an error.
+func RunMappings(log Logger, cfgs []config.Config, parallel bool, fn MappingFunc) error {
+	if len(cfgs) == 1 {
+		return fn(log, 0, cfgs[0])
+	}
+
+	results := make([]mappingResult, len(cfgs))
+	run := func(i int) {
+		start := time.Now()
+		err := fn(log.Tagged(cfgs[i].Name()), i, cfgs[i])
+		results[i] = mappingResult{Err: err, Duration: time.Since(start)}
+	}
+
+	if parallel {
+		var wg sync.WaitGroup
+		wg.Add(len(cfgs))
+		for i := range cfgs {
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range cfgs {
+			run(i)
+		}
+	}
+
+	failed := 0
+	log.Info("Summary of %d mapping(s):", len(cfgs))
+	for i, res := range results {
+		if res.Err != nil {
+			failed++
+			log.Error("  %s: failed after %v: %v", cfgs[i].Name(), res.Duration.Round(time.Second), res.Err)
+		} else {
+			log.Info("  %s: succeeded in %v", cfgs[i].Name(), res.Duration.Round(time.Second))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d mapping(s) failed", failed, len(cfgs))
+	}
+	return nil
+}
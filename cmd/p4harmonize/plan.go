@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// Plan describes the changes needed to make the destination stream match the source client, along
+// with enough information about both servers to detect if either has changed since the plan was made.
+type Plan struct {
+	Mapping string          `json:"mapping,omitempty"` // name of the mapping the plan was made for (empty if there were no mappings)
+	Src     PlanSource      `json:"source"`
+	Dst     PlanDestination `json:"destination"`
+	Diff    DepotFileDiff   `json:"diff"`
+}
+
+// PlanFile holds one plan for each mapping that was planned.
+type PlanFile struct {
+	Plans []Plan `json:"plans"`
+}
+
+type PlanSource struct {
+	P4Port        string `json:"p4port"`
+	Client        string `json:"p4client"`
+	Stream        string `json:"stream,omitempty"`
+	Revision      string `json:"revision,omitempty"`       // revision specifier the plan was made at (empty means #head)
+	Change        int64  `json:"change"`                   // latest submitted change in the client's view (at Revision) when the plan was made
+	EngineVersion string `json:"engine_version,omitempty"` // from EngineVersionPath, if the changelist description uses it
+}
+
+type PlanDestination struct {
+	P4Port string `json:"p4port"`
+	Stream string `json:"stream"`
+	Change int64  `json:"change"` // latest submitted change in the stream when the plan was made
+}
+
+// MakePlan lists the files in the source and destination, then reconciles those lists to find what
+// needs to change in the destination. Nothing is synced in the source, and nothing is created or
+// changed in the destination.
+func MakePlan(log Logger, cfg config.Config) (Plan, error) {
+	var chSrc chan srcThreadResults
+	defer func() {
+		// if we try to early out before our goroutine is done, then wait for it
+		if chSrc != nil {
+			<-chSrc
+		}
+	}()
+
+	// Start listing src in a goroutine
+
+	logSrc := log.Src()
+	shSrc := MakeLoggingBsh(logSrc)
+	chSrc = make(chan srcThreadResults)
+	go func() {
+		defer close(chSrc)
+		chSrc <- srcList(logSrc, shSrc, cfg)
+	}()
+
+	// Grab dst info and list files in the dst stream
+
+	logDst := log.Dst()
+	shDst := MakeLoggingBsh(logDst)
+	p4dst := p4.New(shDst, cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, "")
+
+	logDst.Info("Retrieving info for server %s", p4dst.DisplayName())
+	info, err := p4dst.Info()
+	if err != nil {
+		logDst.Error("Failed getting info from server %s: %v", p4dst.DisplayName(), err)
+		return Plan{}, fmt.Errorf("error prepping destination server")
+	}
+
+	dstChange, err := p4dst.LatestChange(cfg.Dst.ClientStream + "/...")
+	if err != nil {
+		logDst.Error("Failed to get latest change: %v", err)
+		return Plan{}, fmt.Errorf("error prepping destination server")
+	}
+
+	dstFiles, err := dstList(logDst, p4dst, cfg)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	// block until source listing completes
+	srcRes := <-chSrc
+	chSrc = nil
+	if !srcRes.Success {
+		return Plan{}, fmt.Errorf("error listing source files")
+	}
+	if cfg.SameServer() && len(srcRes.Stream) == 0 {
+		log.Src().Error("Source and destination are on the same server, but source client %s is not a stream client.", cfg.Src.P4Client)
+		log.Src().Error("Files are copied on the server from the source's stream, so please use a stream client for the source.")
+		return Plan{}, fmt.Errorf("error prepping source")
+	}
+
+	srcFiles := srcRes.Files
+	filter := NewPathFilter(cfg.Filter)
+	if !filter.IsEmpty() {
+		srcCount, dstCount := len(srcFiles), len(dstFiles)
+		srcFiles = filter.Apply(srcFiles)
+		dstFiles = filter.Apply(dstFiles)
+		log.Info("Filters excluded %d source file(s) and %d destination file(s).",
+			srcCount-len(srcFiles), dstCount-len(dstFiles))
+	}
+
+	typeMapper := NewTypeMapper(cfg.TypeMaps)
+	if !typeMapper.IsEmpty() {
+		var changed int
+		srcFiles, changed = typeMapper.Apply(srcFiles)
+		log.Info("Type maps changed the type of %d source file(s).", changed)
+	}
+
+	log.Info("Reconciling file lists from source and destination...")
+	var diff DepotFileDiff
+	switch info.CaseHandling {
+	case p4.CaseInsensitive:
+		diff = Reconcile(srcFiles, dstFiles, DstIsCaseInsensitive)
+	default:
+		diff = Reconcile(srcFiles, dstFiles)
+	}
+
+	// p4 print only gets the data fork of apple files, so they can't be fetched that way, though on the same
+	// server nothing is printed, since files are copied on the server instead
+	if cfg.Src.Fetch == config.FetchPrint && !cfg.SameServer() {
+		var apple []string
+		for _, pair := range diff.Match {
+			if isAppleType(pair[0].Type) {
+				apple = append(apple, pair[0].Path)
+			}
+		}
+		for _, file := range diff.SrcOnly {
+			if isAppleType(file.Type) {
+				apple = append(apple, file.Path)
+			}
+		}
+		if len(apple) > 0 {
+			log.Error("Files of type apple can't be fetched with 'p4 print', including: %s", apple[0])
+			log.Error("Please set `source.fetch` to '%s' to copy these %d file(s).", config.FetchSync, len(apple))
+			return Plan{}, fmt.Errorf("error planning changes")
+		}
+	}
+
+	// unicode files are only converted between charsets by unicode servers
+	if !cfg.SameServer() && !checkUnicodeFiles(log, cfg, srcRes.Unicode, info.Unicode, FilesToCopy(cfg, diff)) {
+		return Plan{}, fmt.Errorf("error planning changes")
+	}
+
+	plan := Plan{
+		Mapping: cfg.Name(),
+		Src: PlanSource{
+			P4Port:        cfg.Src.P4Port,
+			Client:        cfg.Src.P4Client,
+			Stream:        srcRes.Stream,
+			Revision:      cfg.Src.Revision,
+			Change:        srcRes.Change,
+			EngineVersion: srcRes.EngineVersion,
+		},
+		Dst: PlanDestination{
+			P4Port: cfg.Dst.P4Port,
+			Stream: cfg.Dst.ClientStream,
+			Change: dstChange,
+		},
+		Diff: diff,
+	}
+
+	return plan, nil
+}
+
+// dstList lists the files in the destination stream, as seen through a client of that stream (so that any
+// paths the stream imports or excludes are handled the same way as when the changes are applied). The client
+// named in the config is created just for the listing, then deleted again, so it must not already exist.
+func dstList(logDst Logger, p4dst *p4.P4, cfg config.Config) (files []p4.DepotFile, err error) {
+	exists, err := hasClient(p4dst, cfg.Dst.ClientName)
+	if err != nil {
+		logDst.Error("Failed to get clients from %s: %v", cfg.Dst.P4Port, err)
+		return nil, fmt.Errorf("error prepping destination server")
+	}
+	if exists {
+		logDst.Error("Destination client %s already exists on %s.", cfg.Dst.ClientName, cfg.Dst.P4Port)
+		logDst.Error("Please delete it, or change `destination.new_client_name` in your config file, then try again.")
+		return nil, fmt.Errorf("error prepping destination server")
+	}
+
+	logDst.Info("Creating temporary client %s to list destination files...", cfg.Dst.ClientName)
+	if err := p4dst.CreateStreamClient(cfg.Dst.ClientName, cfg.Dst.ClientRoot, cfg.Dst.ClientStream); err != nil {
+		logDst.Error("Failed to create client %s: %v", cfg.Dst.ClientName, err)
+		return nil, fmt.Errorf("error prepping destination server")
+	}
+	defer func() {
+		if delErr := p4dst.DeleteClient(cfg.Dst.ClientName); delErr != nil {
+			logDst.Error("Unable to delete temporary client %s: %v", cfg.Dst.ClientName, delErr)
+			if err == nil {
+				files, err = nil, fmt.Errorf("error cleaning up")
+			}
+		}
+	}()
+
+	lister := p4.New(MakeLoggingBsh(logDst), cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, cfg.Dst.ClientName)
+	if err := lister.SetStreamName(cfg.Dst.ClientStream); err != nil {
+		logDst.Error("Unexpected error calling SetStreamName(%s): %v", cfg.Dst.ClientStream, err)
+		return nil, fmt.Errorf("error prepping destination server")
+	}
+
+	logDst.Info("Downloading list of current depot files in destination...")
+	files, err = lister.ListDepotFiles()
+	if err != nil {
+		logDst.Error("Failed to list destination files: %v", err)
+		return nil, fmt.Errorf("error prepping destination server")
+	}
+	return files, nil
+}
+
+// CheckConfig returns an error if the plan was made for a different source or destination than
+// the ones in the passed config. The source revision is not checked, since a plan is always applied
+// at the revision it was made at (see withPlanRevision).
+func (p *Plan) CheckConfig(cfg config.Config) error {
+	switch {
+	case p.Mapping != cfg.Name():
+		return fmt.Errorf("plan mapping '%s' does not match config '%s'", p.Mapping, cfg.Name())
+	case p.Src.P4Port != cfg.Src.P4Port:
+		return fmt.Errorf("plan source p4port '%s' does not match config '%s'", p.Src.P4Port, cfg.Src.P4Port)
+	case p.Src.Client != cfg.Src.P4Client:
+		return fmt.Errorf("plan source p4client '%s' does not match config '%s'", p.Src.Client, cfg.Src.P4Client)
+	case p.Dst.P4Port != cfg.Dst.P4Port:
+		return fmt.Errorf("plan destination p4port '%s' does not match config '%s'", p.Dst.P4Port, cfg.Dst.P4Port)
+	case p.Dst.Stream != cfg.Dst.ClientStream:
+		return fmt.Errorf("plan destination stream '%s' does not match config '%s'", p.Dst.Stream, cfg.Dst.ClientStream)
+	}
+	return nil
+}
+
+// withPlanRevision returns a copy of cfg set to harmonize the source at the revision the plan was made at,
+// so that applying or resuming a plan doesn't depend on passing the same --at (or source.revision) again.
+func withPlanRevision(log Logger, cfg config.Config, plan Plan) config.Config {
+	if len(cfg.Src.Revision) > 0 && cfg.Src.Revision != plan.Src.Revision {
+		log.Warning("Ignoring source revision '%s', and using the plan's revision '%s' instead.",
+			cfg.Src.Revision, plan.Src.RevisionOrHead())
+	}
+	cfg.Src.Revision = plan.Src.Revision
+	return cfg
+}
+
+// RevisionOrHead returns the revision specifier the plan was made at, which is "#head" if no revision was set.
+func (s *PlanSource) RevisionOrHead() string {
+	if len(s.Revision) == 0 {
+		return "#head"
+	}
+	return s.Revision
+}
+
+// ContentRevision returns the revision specifier that selects the same source file revisions that the plan
+// was made from (see contentRevision).
+func (s *PlanSource) ContentRevision() string {
+	return contentRevision(s.Revision, s.Change)
+}
+
+// contentRevision returns the revision specifier that selects the source file revisions listed at revision,
+// when the latest change at that revision was change. Revisions that move as changes are submitted (like
+// "#head") are pinned to the change.
+func contentRevision(revision string, change int64) string {
+	if len(revision) == 0 || revision == "#head" {
+		return fmt.Sprintf("@%d", change)
+	}
+	return revision
+}
+
+// Find returns the plan for the named mapping.
+func (f *PlanFile) Find(mapping string) (Plan, bool) {
+	for _, p := range f.Plans {
+		if p.Mapping == mapping {
+			return p, true
+		}
+	}
+	return Plan{}, false
+}
+
+func (f *PlanFile) WriteToFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error opening '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return fmt.Errorf("error encoding/writing '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+func LoadPlanFileFromFile(path string) (PlanFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PlanFile{}, fmt.Errorf("error opening '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	var pf PlanFile
+	if err := json.NewDecoder(f).Decode(&pf); err != nil {
+		return PlanFile{}, fmt.Errorf("error decoding '%s': %w", path, err)
+	}
+	return pf, nil
+}
+
+// RunPlan figures out what needs to change in the destination of each config, logs it, and saves it all
+// in a plan file at the given path, to be applied later by RunApply. Nothing is synced, created, or changed.
+func RunPlan(log Logger, cfgs []config.Config, parallel bool, path string) error {
+	plans := make([]Plan, len(cfgs))
+
+	err := RunMappings(log, cfgs, parallel, func(log Logger, i int, cfg config.Config) error {
+		if !checkLogins(log, cfg) {
+			return fmt.Errorf("pre-flight checks failed")
+		}
+
+		plan, err := MakePlan(log, cfg)
+		if err != nil {
+			return err
+		}
+
+		LogDiff(log, plan.Diff)
+		plans[i] = plan
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	pf := PlanFile{Plans: plans}
+	if err := pf.WriteToFile(path); err != nil {
+		log.Error("Unable to save plan: %v", err)
+		return fmt.Errorf("error saving plan")
+	}
+
+	for _, plan := range plans {
+		tagged := log
+		if len(plan.Mapping) > 0 {
+			tagged = log.Tagged(plan.Mapping)
+		}
+		tagged.Warning("Plan saved to %s (source change %d, destination change %d).", path, plan.Src.Change, plan.Dst.Change)
+	}
+	log.Info("To make these changes, run: p4harmonize apply %s", path)
+	return nil
+}
+
+// RunApply loads the plan file at the given path, then for each config, if neither the source nor the
+// destination has changed since the plan was made, syncs the source and builds a changelist with exactly
+// the planned changes.
+func RunApply(log Logger, cfgs []config.Config, parallel bool, path string, opts Options) error {
+	pf, err := LoadPlanFileFromFile(path)
+	if err != nil {
+		log.Error("Unable to load plan: %v", err)
+		return fmt.Errorf("error loading plan")
+	}
+
+	return RunMappings(log, cfgs, parallel, func(log Logger, _ int, cfg config.Config) error {
+		plan, found := pf.Find(cfg.Name())
+		if !found {
+			log.Error("Plan file %s has no plan for mapping '%s'", path, cfg.Name())
+			return fmt.Errorf("plan does not match config")
+		}
+
+		if err := plan.CheckConfig(cfg); err != nil {
+			log.Error("%v", err)
+			return fmt.Errorf("plan does not match config")
+		}
+		cfg = withPlanRevision(log, cfg, plan)
+
+		if !preFlightChecks(log, cfg) {
+			return fmt.Errorf("pre-flight checks failed")
+		}
+
+		if !checkPlanIsCurrent(log, cfg, plan) {
+			return fmt.Errorf("plan is out of date")
+		}
+
+		if !plan.Diff.HasDifference() {
+			log.Info("All files in source and destination already match, so no harmonizing necessary.")
+			return nil
+		}
+
+		srcRoot, ok := srcSync(log.Src(), cfg, plan)
+		if !ok {
+			return fmt.Errorf("error syncing from source server")
+		}
+
+		return applyPlan(log, cfg, opts, srcRoot, NewJournal(JournalPath(cfg), plan, SplitSettingsFor(cfg.Dst)))
+	})
+}
+
+// checkPlanIsCurrent ensures nothing has been submitted to the source or destination since the plan was made.
+func checkPlanIsCurrent(log Logger, cfg config.Config, plan Plan) bool {
+	logSrc := log.Src()
+	p4src := p4.New(MakeLoggingBsh(logSrc), cfg.Src.P4Port, cfg.Src.P4User, cfg.Src.P4Charset, cfg.Src.P4Client)
+	srcChange, err := p4src.LatestChange(fmt.Sprintf("//%s/...%s", p4src.Client, cfg.Src.RevisionOrHead()))
+	if err != nil {
+		logSrc.Error("Failed to get latest change: %v", err)
+		return false
+	}
+	if srcChange != plan.Src.Change {
+		logSrc.Error("Source has moved from change %d to %d since the plan was made. Please make a new plan.", plan.Src.Change, srcChange)
+		return false
+	}
+
+	logDst := log.Dst()
+	p4dst := p4.New(MakeLoggingBsh(logDst), cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, "")
+	dstChange, err := p4dst.LatestChange(plan.Dst.Stream + "/...")
+	if err != nil {
+		logDst.Error("Failed to get latest change: %v", err)
+		return false
+	}
+	if dstChange != plan.Dst.Change {
+		logDst.Error("Destination has moved from change %d to %d since the plan was made. Please make a new plan.", plan.Dst.Change, dstChange)
+		return false
+	}
+
+	return true
+}
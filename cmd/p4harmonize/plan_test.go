@@ -0,0 +1,119 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/danbrakeley/frog"
+	"github.com/danbrakeley/p4harmonize/internal/config"
+)
+
+// nullLogger returns a Logger that throws away everything logged to it.
+func nullLogger() Logger {
+	return &FrogLog{Logger: &frog.NullLogger{}}
+}
+
+func Test_PlanFileRoundTrip(t *testing.T) {
+	expected := PlanFile{Plans: []Plan{
+		{
+			Mapping: "engine",
+			Src:     PlanSource{P4Port: "src:1666", Client: "src-client", Stream: "//UE5/Release", Change: 1234},
+			Dst:     PlanDestination{P4Port: "dst:1666", Stream: "//proj/engine_epic", Change: 56},
+			Diff:    Reconcile(makeDepotFilesFromString("a,b+d1,c"), makeDepotFilesFromString("b+d2,C,d"), DstIsCaseInsensitive),
+		},
+		{
+			Mapping: "plugin",
+			Src:     PlanSource{P4Port: "src:1666", Client: "plugin-client", Revision: "@label", Change: 1200},
+			Dst:     PlanDestination{P4Port: "dst:1666", Stream: "//proj/plugin_epic", Change: 57},
+			Diff:    Reconcile(makeDepotFilesFromString("x"), nil),
+		},
+	}}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := expected.WriteToFile(path); err != nil {
+		t.Fatalf("%v", err)
+	}
+	actual, err := LoadPlanFileFromFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("Expected:\n%#v\nActual:\n%#v", expected, actual)
+	}
+
+	plan, found := actual.Find("plugin")
+	if !found || plan.Src.Client != "plugin-client" {
+		t.Errorf("expected to find plan for mapping 'plugin', got %v, %#v", found, plan)
+	}
+	if _, found := actual.Find("missing"); found {
+		t.Errorf("expected not to find a plan for mapping 'missing'")
+	}
+}
+
+func Test_PlanCheckConfig(t *testing.T) {
+	plan := Plan{
+		Src: PlanSource{P4Port: "src:1666", Client: "src-client"},
+		Dst: PlanDestination{P4Port: "dst:1666", Stream: "//proj/engine_epic"},
+	}
+
+	var cfg config.Config
+	cfg.Src.P4Port = "src:1666"
+	cfg.Src.P4Client = "src-client"
+	cfg.Dst.P4Port = "dst:1666"
+	cfg.Dst.ClientStream = "//proj/engine_epic"
+
+	if err := plan.CheckConfig(cfg); err != nil {
+		t.Errorf("expected matching config to pass, got: %v", err)
+	}
+
+	cfg.Dst.ClientStream = "//proj/main"
+	if err := plan.CheckConfig(cfg); err == nil {
+		t.Errorf("expected mismatched stream to fail")
+	}
+}
+
+func Test_WithPlanRevision(t *testing.T) {
+	plan := Plan{Src: PlanSource{Revision: "@release-5.4.1"}}
+
+	var cfg config.Config
+	if err := plan.CheckConfig(cfg); err != nil {
+		t.Errorf("expected a config without a revision to pass, got: %v", err)
+	}
+	if actual := withPlanRevision(nullLogger(), cfg, plan); actual.Src.Revision != "@release-5.4.1" {
+		t.Errorf("expected the plan's revision, got '%s'", actual.Src.Revision)
+	}
+
+	cfg.Src.Revision = "@12345"
+	if actual := withPlanRevision(nullLogger(), cfg, plan); actual.Src.Revision != "@release-5.4.1" {
+		t.Errorf("expected the plan's revision to override the config's, got '%s'", actual.Src.Revision)
+	}
+
+	plan.Src.Revision = ""
+	if actual := withPlanRevision(nullLogger(), cfg, plan); actual.Src.Revision != "" {
+		t.Errorf("expected a plan made at #head to clear the config's revision, got '%s'", actual.Src.Revision)
+	}
+}
+
+func Test_ContentRevision(t *testing.T) {
+	var cases = []struct {
+		Revision string
+		Expected string
+	}{
+		{"", "@1234"},
+		{"#head", "@1234"},
+		{"@1200", "@1200"},
+		{"@release-5.4.1", "@release-5.4.1"},
+		{"@2024/05/01", "@2024/05/01"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Revision, func(t *testing.T) {
+			src := PlanSource{Revision: tc.Revision, Change: 1234}
+			if actual := src.ContentRevision(); actual != tc.Expected {
+				t.Errorf("Expected: %s, Actual: %s", tc.Expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl from linux/fs.h, supported by btrfs, xfs (with reflink=1), and others.
+const ficlone = 0x40049409
+
+// reflinkFile creates dstPath as a clone of srcPath, sharing the same blocks on disk until either is
+// written to. Returns an error (and leaves no file at dstPath) if the filesystem can't clone files.
+func reflinkFile(srcPath, dstPath string) error {
+	s, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("unable to open '%s': %w", srcPath, err)
+	}
+	defer s.Close()
+
+	d, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("unable to create '%s': %w", dstPath, err)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), ficlone, s.Fd())
+	d.Close()
+	if errno != 0 {
+		os.Remove(dstPath)
+		return fmt.Errorf("unable to clone '%s' to '%s': %w", srcPath, dstPath, errno)
+	}
+	return nil
+}
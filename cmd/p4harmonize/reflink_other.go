@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// reflinkFile is only supported on linux, so always returns an error.
+func reflinkFile(srcPath, dstPath string) error {
+	return fmt.Errorf("unable to clone '%s' to '%s': not supported on this platform", srcPath, dstPath)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// DiffSummary counts each kind of change that harmonizing a DepotFileDiff would make in the destination.
+// Note that a single pair of matched files may contribute to more than one of CaseFixes, TypeChanges,
+// and ContentChanges.
+type DiffSummary struct {
+	Adds           int // files only in the source
+	Deletes        int // files only in the destination
+	CaseFixes      int // files whose path differs only in case, fixed with a move
+	CaseMismatches int // files whose path differs only in case, fixed with a delete and a later re-add
+	TypeChanges    int // files whose type differs
+	ContentChanges int // files whose content differs (or whose digest is not known)
+}
+
+// Summarize counts the changes described by this DepotFileDiff.
+func (d *DepotFileDiff) Summarize() DiffSummary {
+	s := DiffSummary{
+		Adds:           len(d.SrcOnly),
+		Deletes:        len(d.DstOnly),
+		CaseMismatches: len(d.CaseMismatch),
+	}
+	for _, pair := range d.Match {
+		if pair[0].Path != pair[1].Path {
+			s.CaseFixes++
+		}
+		if hasTypeDifference(pair) {
+			s.TypeChanges++
+		}
+		if hasContentDifference(pair) {
+			s.ContentChanges++
+		}
+	}
+	return s
+}
+
+// hasTypeDifference uses the same logic as Reconcile to decide if the types of a pair of files differ.
+// Different spellings of the same type (ie "ktext" and "text+k") are not a difference.
+func hasTypeDifference(pair [2]p4.DepotFile) bool {
+	return !p4.SameFileType(pair[0].Type, pair[1].Type)
+}
+
+// hasContentDifference uses the same logic as Reconcile to decide if the contents of a pair
+// of files differ. A missing digest is assumed to be a difference.
+func hasContentDifference(pair [2]p4.DepotFile) bool {
+	return len(pair[0].Digest) == 0 || pair[0].Digest != pair[1].Digest
+}
+
+// LogDiff logs every change that harmonizing the passed DepotFileDiff would make in the destination,
+// grouped by the kind of change, followed by the total count of each kind of change.
+func LogDiff(log Logger, diff DepotFileDiff) {
+	if !diff.HasDifference() {
+		log.Info("All files in source and destination already match, so no harmonizing necessary.")
+		return
+	}
+
+	if len(diff.SrcOnly) > 0 {
+		log.Info("Files to add:")
+		for _, f := range diff.SrcOnly {
+			log.InfoFast(fmt.Sprintf("  add     %s (%s)", f.Path, f.Type))
+		}
+	}
+
+	if len(diff.DstOnly) > 0 {
+		log.Info("Files to delete:")
+		for _, f := range diff.DstOnly {
+			log.InfoFast(fmt.Sprintf("  delete  %s", f.Path))
+		}
+	}
+
+	if len(diff.Match) > 0 {
+		log.Info("Files to change:")
+		for _, pair := range diff.Match {
+			if pair[0].Path != pair[1].Path {
+				log.InfoFast(fmt.Sprintf("  move    %s -> %s", pair[1].Path, pair[0].Path))
+			}
+			if hasTypeDifference(pair) {
+				log.InfoFast(fmt.Sprintf("  retype  %s (%s -> %s)", pair[0].Path, pair[1].Type, pair[0].Type))
+			}
+			if hasContentDifference(pair) {
+				log.InfoFast(fmt.Sprintf("  edit    %s", pair[0].Path))
+			}
+		}
+	}
+
+	if len(diff.CaseMismatch) > 0 {
+		log.Info("Files to delete now, then re-add with the correct case in a second pass:")
+		for _, pair := range diff.CaseMismatch {
+			log.InfoFast(fmt.Sprintf("  recase  %s -> %s", pair[1].Path, pair[0].Path))
+		}
+	}
+
+	s := diff.Summarize()
+	log.Info("Summary: %d add(s), %d delete(s), %d case fix(es), %d type change(s), %d content change(s), "+
+		"%d case mismatch(es) needing a second pass",
+		s.Adds, s.Deletes, s.CaseFixes, s.TypeChanges, s.ContentChanges, s.CaseMismatches)
+}
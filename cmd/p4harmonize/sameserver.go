@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// integrateChanges does the same job as copyChanges, but for when the source and destination are on the
+// same server. New and changed files are copied on the server from the source stream with "p4 copy", which
+// keeps their integration history, and doesn't transfer any file content. Files whose path changed case
+// are deleted at their old path and copied to their new one, so the new path is branched from the source.
+// Files where only the type changed are opened for edit with the new type (since "p4 copy" would skip
+// them), after syncing the destination's own copy, which already has the right content.
+func (b *clBuilder) integrateChanges(matches [][2]p4.DepotFile, srcOnly []p4.DepotFile) error {
+	logDst, p4dst, cl := b.logDst, b.p4dst, b.cl
+	plan := b.journal.Plan
+
+	typeOnly, moves, toCopy := splitSameServerWork(matches, srcOnly)
+
+	// Delete the old path of each file with the capitalization different; the new path is copied below.
+	if len(moves) > 0 && !b.journal.IsDone(b.step(StepMove)) {
+		pathsToDelete := make([]string, 0, len(moves))
+		for _, pair := range moves {
+			pathsToDelete = append(pathsToDelete, filepath.Join(b.dstClientRoot, pair[1].Path))
+		}
+		if err := p4dst.Delete(pathsToDelete, p4.Changelist(cl)); err != nil {
+			logDst.Error("Unable to open %d file(s) for delete: %v", len(pathsToDelete), err)
+			return fmt.Errorf("error while building changelist")
+		}
+		if err := b.done(b.step(StepMove)); err != nil {
+			return err
+		}
+	}
+
+	// For each file where only the type is different, fill in the content, then open it with the new type.
+	for newType, diffFiles := range GroupFilePairsByType(typeOnly) {
+		editStep := b.step(StepFor(StepEdit, newType))
+		if b.journal.IsDone(editStep) {
+			continue
+		}
+
+		pathsToSync := make([]string, 0, len(diffFiles))
+		pathsToEdit := make([]string, 0, len(diffFiles))
+		for _, pair := range diffFiles {
+			dstPath := filepath.Join(b.dstClientRoot, pair[1].Path)
+			pathsToSync = append(pathsToSync, dstPath+"#have")
+			pathsToEdit = append(pathsToEdit, dstPath)
+		}
+
+		if err := p4dst.SyncFiles(pathsToSync, p4.Force); err != nil {
+			logDst.Error("Unable to sync %d file(s): %v", len(pathsToSync), err)
+			return fmt.Errorf("error while building changelist")
+		}
+		if err := p4dst.Edit(pathsToEdit, p4.Changelist(cl), p4.Type(newType)); err != nil {
+			logDst.Error("Unable to open %d file(s) for edit: %v", len(pathsToEdit), err)
+			return fmt.Errorf("error while building changelist")
+		}
+		if err := b.done(editStep); err != nil {
+			return err
+		}
+	}
+
+	// Everything else is copied on the server, using a temporary branch spec that maps the source stream
+	// to the destination stream.
+	if len(toCopy) > 0 && !b.journal.IsDone(b.step(StepCopy)) {
+		branch := "p4harmonize-" + b.cfg.Dst.ClientName
+
+		logDst.Info("Copying %d file(s) from %s on the server...", len(toCopy), plan.Src.Stream)
+		if err := p4dst.CreateBranch(branch, sameServerView(plan)); err != nil {
+			logDst.Error("%v", err)
+			return fmt.Errorf("error while building changelist")
+		}
+		defer func() {
+			if err := p4dst.DeleteBranch(branch); err != nil {
+				logDst.Warning("Unable to delete temporary branch spec: %v", err)
+			}
+		}()
+
+		targets := copyTargets(plan.Dst.Stream, toCopy, plan.Src.ContentRevision())
+		if err := p4dst.CopyBranch(branch, targets, p4.Changelist(cl)); err != nil {
+			logDst.Error("Unable to copy %d file(s): %v", len(toCopy), err)
+			return fmt.Errorf("error while building changelist")
+		}
+
+		// p4 copy keeps the source's type, which a type map may have changed
+		for srcType, srcFiles := range GroupFilesByType(toCopy) {
+			paths := make([]string, 0, len(srcFiles))
+			for _, src := range srcFiles {
+				paths = append(paths, filepath.Join(b.dstClientRoot, src.Path))
+			}
+			if err := p4dst.Reopen(paths, p4.Changelist(cl), p4.Type(srcType)); err != nil {
+				logDst.Error("Unable to set type of %d file(s) to %s: %v", len(paths), srcType, err)
+				return fmt.Errorf("error while building changelist")
+			}
+		}
+
+		if err := b.done(b.step(StepCopy)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitSameServerWork sorts the files to be opened by integrateChanges into matches where only the type is
+// different, matches where the path's capitalization is different, and the source files to be copied on the
+// server, which includes the source side of each of those moves.
+func splitSameServerWork(matches [][2]p4.DepotFile, srcOnly []p4.DepotFile) (typeOnly, moves [][2]p4.DepotFile, toCopy []p4.DepotFile) {
+	typeOnly, rest := SplitTypeOnlyChanges(matches)
+	for _, pair := range rest {
+		if pair[0].Path != pair[1].Path {
+			moves = append(moves, pair)
+		}
+		toCopy = append(toCopy, pair[0])
+	}
+	toCopy = append(toCopy, srcOnly...)
+	return typeOnly, moves, toCopy
+}
+
+// sameServerView returns the view of the temporary branch spec used by integrateChanges, which maps the
+// whole source stream onto the destination stream.
+func sameServerView(plan Plan) [][2]string {
+	return [][2]string{{plan.Src.Stream + "/...", plan.Dst.Stream + "/..."}}
+}
+
+// copyTargets returns the depot path in the destination stream of each of the given source files, with the
+// revision of the source to copy them from.
+func copyTargets(dstStream string, files []p4.DepotFile, revision string) []string {
+	out := make([]string, 0, len(files))
+	for _, f := range files {
+		out = append(out, dstStream+"/"+f.Path+revision)
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+func Test_SplitSameServerWork(t *testing.T) {
+	matches := [][2]p4.DepotFile{
+		{{Path: "content.txt", Type: "text", Digest: "a"}, {Path: "content.txt", Type: "text", Digest: "b"}},
+		{{Path: "type.bin", Type: "binary+w", Digest: "a"}, {Path: "type.bin", Type: "binary", Digest: "a"}},
+		{{Path: "Moved.txt", Type: "text", Digest: "a"}, {Path: "moved.txt", Type: "text", Digest: "a"}},
+	}
+	srcOnly := []p4.DepotFile{{Path: "new.txt", Type: "text"}}
+
+	typeOnly, moves, toCopy := splitSameServerWork(matches, srcOnly)
+
+	if len(typeOnly) != 1 || typeOnly[0][0].Path != "type.bin" {
+		t.Errorf("expected type.bin to be the only type change, got %v", typeOnly)
+	}
+	if len(moves) != 1 || moves[0][0].Path != "Moved.txt" || moves[0][1].Path != "moved.txt" {
+		t.Errorf("expected moved.txt to Moved.txt to be the only move, got %v", moves)
+	}
+	var paths []string
+	for _, f := range toCopy {
+		paths = append(paths, f.Path)
+	}
+	if actual, expected := strings.Join(paths, ","), "content.txt,Moved.txt,new.txt"; actual != expected {
+		t.Errorf("expected to copy %s, got %s", expected, actual)
+	}
+}
+
+func Test_SameServerView(t *testing.T) {
+	plan := Plan{
+		Src: PlanSource{Stream: "//src/main"},
+		Dst: PlanDestination{Stream: "//dst/main"},
+	}
+
+	view := sameServerView(plan)
+	if len(view) != 1 {
+		t.Fatalf("expected a single view line, got %d", len(view))
+	}
+	if view[0][0] != "//src/main/..." || view[0][1] != "//dst/main/..." {
+		t.Errorf("expected //src/main/... to map to //dst/main/..., got %s to %s", view[0][0], view[0][1])
+	}
+}
+
+func Test_CopyTargets(t *testing.T) {
+	var cases = []struct {
+		Name     string
+		Revision string
+		Expected string
+	}{
+		{"change", "@123", "//dst/main/a.txt@123,//dst/main/dir/b%40c.txt@123"},
+		{"label", "@my_label", "//dst/main/a.txt@my_label,//dst/main/dir/b%40c.txt@my_label"},
+	}
+
+	files := []p4.DepotFile{{Path: "a.txt"}, {Path: "dir/b%40c.txt"}}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := strings.Join(copyTargets("//dst/main", files, tc.Revision), ",")
+			if actual != tc.Expected {
+				t.Errorf("expected %s, got %s", tc.Expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+)
+
+// SplitSettings are the destination settings that decide how the changes are split across changelists.
+// They are saved in the journal, since the steps it records for each changelist are only meaningful if
+// the changes are split the same way when resuming.
+type SplitSettings struct {
+	MaxFilesPerChangelist  int   `json:"max_files_per_changelist,omitempty"`
+	MaxBytesPerChangelist  int64 `json:"max_bytes_per_changelist,omitempty"`
+	ChangelistPerDirectory bool  `json:"changelist_per_directory,omitempty"`
+}
+
+// SplitSettingsFor returns the split settings of the passed destination.
+func SplitSettingsFor(dst config.Destination) SplitSettings {
+	return SplitSettings{
+		MaxFilesPerChangelist:  dst.MaxFilesPerChangelist,
+		MaxBytesPerChangelist:  dst.MaxBytesPerChangelist,
+		ChangelistPerDirectory: config.Enabled(dst.ChangelistPerDirectory),
+	}
+}
+
+// splitItem is a single change from a DepotFileDiff, along with what's needed to decide which
+// changelist it goes in.
+type splitItem struct {
+	key  string // lowercase path, with any AppleDouble "%" prefix removed from the file name
+	size int64  // bytes that will be opened for add or edit (zero for deletes)
+	add  func(d *DepotFileDiff)
+}
+
+// SplitDiff divides the changes in diff into one DepotFileDiff per changelist, keeping each changelist
+// within the limits set in dst. Changes are kept in path order, so each changelist covers a contiguous
+// range of paths. A file and its AppleDouble "%" file are always kept in the same changelist, and a file
+// larger than MaxBytesPerChangelist gets a changelist of its own.
+// If dst sets no limits, then the returned slice just holds diff.
+func SplitDiff(diff DepotFileDiff, dst config.Destination) []DepotFileDiff {
+	if !dst.SplitsChangelists() {
+		return []DepotFileDiff{diff}
+	}
+
+	items := make([]splitItem, 0, len(diff.Match)+len(diff.SrcOnly)+len(diff.DstOnly)+len(diff.CaseMismatch))
+	for _, pair := range diff.Match {
+		pair := pair
+		items = append(items, splitItem{splitKey(pair[1].Path), pair[0].Size, func(d *DepotFileDiff) {
+			d.Match = append(d.Match, pair)
+		}})
+	}
+	for _, file := range diff.SrcOnly {
+		file := file
+		items = append(items, splitItem{splitKey(file.Path), file.Size, func(d *DepotFileDiff) {
+			d.SrcOnly = append(d.SrcOnly, file)
+		}})
+	}
+	for _, file := range diff.DstOnly {
+		file := file
+		items = append(items, splitItem{splitKey(file.Path), 0, func(d *DepotFileDiff) {
+			d.DstOnly = append(d.DstOnly, file)
+		}})
+	}
+	for _, pair := range diff.CaseMismatch {
+		pair := pair
+		items = append(items, splitItem{splitKey(pair[1].Path), 0, func(d *DepotFileDiff) {
+			d.CaseMismatch = append(d.CaseMismatch, pair)
+		}})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].key < items[j].key })
+
+	var out []DepotFileDiff
+	var cur DepotFileDiff
+	var files int
+	var bytes int64
+	var prevKey string
+	for _, item := range items {
+		// only start a new changelist between files that don't have to stay together
+		if files > 0 && item.key != prevKey {
+			newDir := config.Enabled(dst.ChangelistPerDirectory) && topLevelDir(item.key) != topLevelDir(prevKey)
+			tooMany := dst.MaxFilesPerChangelist > 0 && files >= dst.MaxFilesPerChangelist
+			tooBig := dst.MaxBytesPerChangelist > 0 && bytes+item.size > dst.MaxBytesPerChangelist
+			if newDir || tooMany || tooBig {
+				out = append(out, cur)
+				cur = DepotFileDiff{}
+				files, bytes = 0, 0
+			}
+		}
+		item.add(&cur)
+		files++
+		bytes += item.size
+		prevKey = item.key
+	}
+	if files > 0 {
+		out = append(out, cur)
+	}
+
+	return out
+}
+
+// splitKey returns the key used to order and group a (perforce escaped) path when splitting a diff.
+func splitKey(p string) string {
+	dir, name := path.Split(strings.ToLower(p))
+	return dir + strings.TrimPrefix(name, "%25")
+}
+
+// topLevelDir returns the first directory in the path, or an empty string for files in the root.
+func topLevelDir(p string) string {
+	i := strings.Index(p, "/")
+	if i < 0 {
+		return ""
+	}
+	return p[:i]
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+func Test_SplitDiff(t *testing.T) {
+	diff := DepotFileDiff{
+		Match:   [][2]p4.DepotFile{{{Path: "Engine/b", Size: 40}, {Path: "Engine/b"}}},
+		SrcOnly: []p4.DepotFile{{Path: "Engine/a", Size: 70}, {Path: "Engine/c", Size: 10}, {Path: "Game/x", Size: 5}},
+		DstOnly: []p4.DepotFile{{Path: "Engine/d"}, {Path: "Game/%25x"}},
+	}
+
+	var cases = []struct {
+		Name     string
+		Dst      config.Destination
+		Expected []int // number of changes in each diff
+	}{
+		{"no limits", config.Destination{}, []int{6}},
+		{"max files", config.Destination{MaxFilesPerChangelist: 2}, []int{2, 2, 2}},
+		{"max bytes", config.Destination{MaxBytesPerChangelist: 100}, []int{1, 5}},
+		{"per directory", config.Destination{ChangelistPerDirectory: config.Bool(true)}, []int{4, 2}},
+		{"apple double stays together", config.Destination{MaxFilesPerChangelist: 5}, []int{6}},
+		{"oversized file gets its own", config.Destination{MaxBytesPerChangelist: 50}, []int{1, 3, 2}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := SplitDiff(diff, tc.Dst)
+			if len(actual) != len(tc.Expected) {
+				t.Fatalf("expected %d diffs, got %d: %v", len(tc.Expected), len(actual), actual)
+			}
+			for i, d := range actual {
+				n := len(d.Match) + len(d.SrcOnly) + len(d.DstOnly) + len(d.CaseMismatch)
+				if n != tc.Expected[i] {
+					t.Errorf("expected diff %d to have %d changes, got %d: %v", i, tc.Expected[i], n, d)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+// TypeMapper changes the types of source files, based on the type_map rules in config.
+type TypeMapper struct {
+	rules []typeMapRule
+}
+
+type typeMapRule struct {
+	from  string
+	to    string
+	paths []*regexp.Regexp
+}
+
+func NewTypeMapper(maps []config.TypeMap) *TypeMapper {
+	tm := &TypeMapper{rules: make([]typeMapRule, 0, len(maps))}
+	for _, m := range maps {
+		rule := typeMapRule{from: m.From, to: m.To}
+		for _, pattern := range m.Paths {
+			rule.paths = append(rule.paths, p4.WildcardRegexp(pattern))
+		}
+		tm.rules = append(tm.rules, rule)
+	}
+	return tm
+}
+
+// IsEmpty returns true if there are no rules, and so no types would ever change.
+func (tm *TypeMapper) IsEmpty() bool {
+	return len(tm.rules) == 0
+}
+
+// TypeFor returns the type a file with the given path and type should have. The first rule that matches
+// wins, where a rule's type matches any spelling of the same type (ie "ktext" matches "text+k"). If no
+// rules match, then the passed type is returned unchanged.
+func (tm *TypeMapper) TypeFor(path, filetype string) string {
+	for _, rule := range tm.rules {
+		if !p4.SameFileType(rule.from, filetype) {
+			continue
+		}
+		if len(rule.paths) == 0 {
+			return rule.to
+		}
+		// patterns are written without perforce's escaping (ie "@", not "%40"), so unescape before matching
+		unescaped, err := p4.UnescapePath(path)
+		if err != nil {
+			unescaped = path
+		}
+		for _, re := range rule.paths {
+			if re.MatchString(unescaped) {
+				return rule.to
+			}
+		}
+	}
+	return filetype
+}
+
+// Apply returns a copy of the passed files, with types changed by any matching rules, along with the
+// number of files whose types were changed. Each changed file keeps its original type in OrigType.
+func (tm *TypeMapper) Apply(files []p4.DepotFile) ([]p4.DepotFile, int) {
+	if tm.IsEmpty() {
+		return files, 0
+	}
+
+	out := make([]p4.DepotFile, len(files))
+	changed := 0
+	for i, file := range files {
+		newType := tm.TypeFor(file.Path, file.Type)
+		if newType != file.Type {
+			file.OrigType = file.Type
+			file.Type = newType
+			changed++
+		}
+		out[i] = file
+	}
+	return out, changed
+}
+
+// depotType returns the type of the file in its depot, before any type map changed it.
+func depotType(file p4.DepotFile) string {
+	if len(file.OrigType) > 0 {
+		return file.OrigType
+	}
+	return file.Type
+}
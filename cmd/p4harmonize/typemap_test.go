@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/danbrakeley/p4harmonize/internal/config"
+	"github.com/danbrakeley/p4harmonize/internal/p4"
+)
+
+func Test_TypeMapper(t *testing.T) {
+	tm := NewTypeMapper([]config.TypeMap{
+		{From: "binary+l", To: "binary+Sl", Paths: []string{".../Cooked/..."}},
+		{From: "text", To: "utf8", Paths: []string{"*.ini", ".../*.ini"}},
+		{From: "text", To: "text+k"},
+	})
+
+	var cases = []struct {
+		Path     string
+		Type     string
+		Expected string
+	}{
+		{"Engine/Cooked/chair.uasset", "binary+l", "binary+Sl"},
+		{"Engine/Content/chair.uasset", "binary+l", "binary+l"},
+		{"Engine/Cooked/chair.uasset", "binary", "binary"},
+		{"Engine/Config/Base.ini", "text", "utf8"},
+		{"Default.ini", "text", "utf8"},
+		{"Engine/build.cs", "text", "text+k"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Path+" "+tc.Type, func(t *testing.T) {
+			actual := tm.TypeFor(tc.Path, tc.Type)
+			if actual != tc.Expected {
+				t.Errorf("Expected: %s, Actual: %s", tc.Expected, actual)
+			}
+		})
+	}
+
+	files := []p4.DepotFile{
+		{Path: "Engine/Cooked/a.uasset", Type: "binary+l"},
+		{Path: "Engine/b.uasset", Type: "binary+l"},
+	}
+	mapped, changed := tm.Apply(files)
+	if changed != 1 || mapped[0].Type != "binary+Sl" || mapped[1].Type != "binary+l" ||
+		depotType(mapped[0]) != "binary+l" || len(mapped[1].OrigType) > 0 {
+		t.Errorf("unexpected result from Apply: %d changed, %#v", changed, mapped)
+	}
+	if files[0].Type != "binary+l" {
+		t.Errorf("expected Apply to leave the passed files unchanged")
+	}
+}
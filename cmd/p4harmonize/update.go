@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/danbrakeley/bsh"
 	"github.com/danbrakeley/p4harmonize/internal/config"
@@ -13,21 +15,27 @@ import (
 )
 
 type srcThreadResults struct {
-	Success    bool
-	ClientRoot string
-	Files      []p4.DepotFile
+	Success       bool
+	Stream        string
+	Unicode       bool // true if the source server is in unicode mode
+	Change        int64
+	EngineVersion string // only read if the changelist description uses it
+	Files         []p4.DepotFile
 }
 
-func Harmonize(log Logger, cfg config.Config) error {
-	var chSrc chan srcThreadResults
-	defer func() {
-		// if we try to early out before our goroutine is done, then wait for it
-		if chSrc != nil {
-			<-chSrc
-		}
-	}()
+// Options holds the settings that change how Harmonize runs, and that don't come from the config file.
+type Options struct {
+	DryRun bool // report the differences, but don't create a client or changelist in the destination
+	Resume bool // pick up where a failed run left off, using the journal it left behind
+	Shelve bool // shelve the finished changelist, then revert its files in the client (keeping the local files)
 
-	var err error
+	CopyWorkers int // how many files to copy at the same time (less than 1 means one per CPU)
+}
+
+func Harmonize(log Logger, cfg config.Config, opts Options) error {
+	if opts.Resume {
+		return resume(log, cfg, opts)
+	}
 
 	// Ensure dst root folder and dst client don't already exist
 
@@ -35,39 +43,140 @@ func Harmonize(log Logger, cfg config.Config) error {
 		return fmt.Errorf("pre-flight checks failed")
 	}
 
-	// Start sync from src in a goroutine
+	// List src and dst, and reconcile
 
-	logSrc := log.Src()
-	shSrc := MakeLoggingBsh(logSrc)
-	chSrc = make(chan srcThreadResults)
-	go func() {
-		defer close(chSrc)
-		chSrc <- srcSyncAndList(logSrc, shSrc, cfg)
-	}()
+	plan, err := MakePlan(log, cfg)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		LogDiff(log, plan.Diff)
+		log.Warning("Dry run complete. Only a temporary client was created in the destination (and deleted again); no changelist or files were created.")
+		return nil
+	}
+
+	// early out if there's nothing to reconcile
+	if !plan.Diff.HasDifference() {
+		log.Info("All files in source and destination already match, so no harmonizing necessary.")
+		return nil
+	}
+
+	// Sync just the src files that need to be copied
+
+	srcRoot, ok := srcSync(log.Src(), cfg, plan)
+	if !ok {
+		return fmt.Errorf("error syncing from source server")
+	}
+
+	return applyPlan(log, cfg, opts, srcRoot, NewJournal(JournalPath(cfg), plan, SplitSettingsFor(cfg.Dst)))
+}
+
+// resume loads the journal left behind by a failed run, and if neither server has changed since,
+// finishes applying the journal's plan, skipping any steps that already completed.
+func resume(log Logger, cfg config.Config, opts Options) error {
+	path := JournalPath(cfg)
+	journal, err := LoadJournalFromFile(path)
+	if err != nil {
+		log.Error("Unable to load journal: %v", err)
+		return fmt.Errorf("nothing to resume")
+	}
+
+	log.Info("Resuming from journal %s", path)
+
+	if err := journal.Plan.CheckConfig(cfg); err != nil {
+		log.Error("%v", err)
+		return fmt.Errorf("journal does not match config")
+	}
+	cfg = withPlanRevision(log, cfg, journal.Plan)
+
+	// the journal's steps for each changelist only line up if the changes are split the same way again
+	if SplitSettingsFor(cfg.Dst) != journal.Split {
+		log.Error("The changelist limits in the config have changed since the failed run started.")
+		log.Error("Please set them back to max_files_per_changelist = %d, max_bytes_per_changelist = %d, "+
+			"and changelist_per_directory = %v, then try again.",
+			journal.Split.MaxFilesPerChangelist, journal.Split.MaxBytesPerChangelist, journal.Split.ChangelistPerDirectory)
+		return fmt.Errorf("journal does not match config")
+	}
+
+	if !checkLogins(log, cfg) {
+		return fmt.Errorf("pre-flight checks failed")
+	}
+
+	if !checkPlanIsCurrent(log, cfg, journal.Plan) {
+		log.Error("Please revert and delete the changelist and client left by the failed run, " +
+			"delete the journal and the client root, then try again.")
+		return fmt.Errorf("journal is out of date")
+	}
+
+	srcRoot, ok := srcSync(log.Src(), cfg, journal.Plan)
+	if !ok {
+		return fmt.Errorf("error syncing from source server")
+	}
+
+	return applyPlan(log, cfg, opts, srcRoot, journal)
+}
+
+// applyPlan builds a changelist in the destination that makes the destination match the source, as
+// described by the journal's plan. Files are copied from srcRoot, which must already be synced.
+// Each completed step is recorded in the journal, and any steps the journal says are already complete
+// are skipped. The journal is removed once every step has completed.
+func applyPlan(log Logger, cfg config.Config, opts Options, srcRoot string, journal *Journal) error {
+	if cfg.SyncsSource() && !MakeLoggingBsh(log.Src()).IsDir(srcRoot) {
+		log.Src().Error("Client root '%s' is missing or is not a folder", srcRoot)
+		return fmt.Errorf("unexpected local file error")
+	}
+
+	if err := journal.Save(); err != nil {
+		log.Error("Unable to save journal: %v", err)
+		return fmt.Errorf("error prepping for changes")
+	}
+
+	if err := applyPlanSteps(log, cfg, opts, srcRoot, journal); err != nil {
+		log.Warning("Progress was saved to %s.", journal.Path())
+		log.Warning("Once the problem is fixed, run p4harmonize again with --resume to continue from where it stopped.")
+		return err
+	}
+
+	if err := journal.Remove(); err != nil {
+		log.Warning("Unable to remove journal: %v", err)
+	}
+	return nil
+}
 
-	// Grab dst info and create dst client
+func applyPlanSteps(log Logger, cfg config.Config, opts Options, srcRoot string, journal *Journal) error {
+	diff := journal.Plan.Diff
 
 	logDst := log.Dst()
 	shDst := MakeLoggingBsh(logDst)
 	p4dst := p4.New(shDst, cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, "")
 
-	logDst.Info("Retrieving info for server %s", p4dst.DisplayName())
-	info, err := p4dst.Info()
-	if err != nil {
-		logDst.Error("Failed getting info from server %s: %w", p4dst.DisplayName(), err)
-		return fmt.Errorf("error prepping destination server")
+	// helper to record a completed step
+	done := func(step string) error {
+		if err := journal.Done(step); err != nil {
+			log.Error("Unable to save journal: %v", err)
+			return fmt.Errorf("error saving progress")
+		}
+		return nil
 	}
 
-	logDst.Info("Creating client %s on %s...", cfg.Dst.ClientName, p4dst.DisplayName())
+	// Create dst client
 
-	err = p4dst.CreateStreamClient(cfg.Dst.ClientName, cfg.Dst.ClientRoot, cfg.Dst.ClientStream)
-	if err != nil {
-		logDst.Error("Failed to create client %s: %w", p4dst.Client, err)
-		return fmt.Errorf("error prepping destination server")
+	if !journal.IsDone(StepClient) {
+		logDst.Info("Creating client %s on %s...", cfg.Dst.ClientName, p4dst.DisplayName())
+
+		err := p4dst.CreateStreamClient(cfg.Dst.ClientName, cfg.Dst.ClientRoot, cfg.Dst.ClientStream)
+		if err != nil {
+			logDst.Error("Failed to create client %s: %v", cfg.Dst.ClientName, err)
+			return fmt.Errorf("error prepping destination server")
+		}
+		if err := done(StepClient); err != nil {
+			return err
+		}
 	}
 	// set p4dst's client and stream name
 	p4dst.Client = cfg.Dst.ClientName
-	err = p4dst.SetStreamName(cfg.Dst.ClientStream)
+	err := p4dst.SetStreamName(cfg.Dst.ClientStream)
 	if err != nil {
 		logDst.Error("Unexpected error calling SetStreamName(%s): %v", cfg.Dst.ClientStream, err)
 		return fmt.Errorf("error prepping destination server")
@@ -75,129 +184,403 @@ func Harmonize(log Logger, cfg config.Config) error {
 
 	// Force perforce to think you have synced everything already
 
-	logDst.Info("Slamming %s to head without transferring any files...", cfg.Dst.ClientName)
-	err = p4dst.SyncLatestNoDownload()
-	if err != nil {
-		logDst.Error("Failed to update server's view of your local files: %v", err)
-		return fmt.Errorf("error prepping destination server")
+	if !journal.IsDone(StepSync) {
+		logDst.Info("Slamming %s to head without transferring any files...", cfg.Dst.ClientName)
+		err = p4dst.SyncLatestNoDownload()
+		if err != nil {
+			logDst.Error("Failed to update server's view of your local files: %v", err)
+			return fmt.Errorf("error prepping destination server")
+		}
+		if err := done(StepSync); err != nil {
+			return err
+		}
 	}
 
-	// Grab the full list of files
-
-	logDst.Info("Downloading list of current depot files in destination...")
-	dstFiles, err := p4dst.ListDepotFiles()
+	dstClientRoot, err := filepath.Abs(cfg.Dst.ClientRoot)
 	if err != nil {
-		logDst.Error("Failed to list destination files: %v", err)
-		return fmt.Errorf("error prepping destination server")
+		logDst.Error("Unable to get absolute path for '%s': %v", cfg.Dst.ClientRoot, err)
+		return fmt.Errorf("error prepping for changes")
 	}
 
-	// block until sync source sync completes
-	srcRes := <-chSrc
-	chSrc = nil
-	if !srcRes.Success {
-		return fmt.Errorf("error syncing from source server")
+	// If allowed, fix case mismatches now, by submitting their deletion in a changelist of its own,
+	// after which they are just files that need to be added.
+	if config.Enabled(cfg.Dst.SubmitCaseFixes) && !journal.IsDone(StepCaseFix) && len(diff.CaseMismatch) > 0 {
+		if err := submitCaseFixes(log, p4dst, dstClientRoot, journal); err != nil {
+			return err
+		}
+		diff = journal.Plan.Diff
 	}
 
-	if !shSrc.IsDir(srcRes.ClientRoot) {
-		logSrc.Error("Client root '%s' is missing or is not a folder", srcRes.ClientRoot)
-		return fmt.Errorf("unexpected local file error")
+	copySettings, ok := copySettingsFor(log, cfg, p4dst)
+	if !ok {
+		return fmt.Errorf("error prepping for changes")
 	}
 
-	log.Info("Reconciling file lists from source and destination...")
-	var diff DepotFileDiff
-	switch info.CaseHandling {
-	case p4.CaseInsensitive:
-		diff = Reconcile(srcRes.Files, dstFiles, DstIsCaseInsensitive)
-	default:
-		diff = Reconcile(srcRes.Files, dstFiles)
+	chunks := SplitDiff(diff, cfg.Dst)
+	if len(chunks) > 1 {
+		log.Info("Changes will be split across %d changelists.", len(chunks))
 	}
 
-	// early out if there's nothing to reconcile
-	if !diff.HasDifference() {
-		log.Info("All files in source and destination already match, so no harmonizing necessary.")
-		logDst.Info("Removing unused client...")
-		err := p4dst.DeleteClient(p4dst.Client)
+	cls := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		cl, err := buildChangelist(log, cfg, opts, p4dst, srcRoot, dstClientRoot, copySettings, journal, chunk, i, len(chunks))
 		if err != nil {
-			logDst.Error("Error deleting client %s: %v", p4dst.Client, err)
-			return fmt.Errorf("error cleaning up")
+			return err
 		}
-		return nil
+		cls[i] = cl
 	}
 
-	logDst.Info("Creating changelist in destination...")
-	cl, err := p4dst.CreateEmptyChangelist("p4harmonize")
+	root, err := filepath.Abs(cfg.Dst.ClientRoot)
 	if err != nil {
-		logDst.Error("Unable to create new changelist: %v", err)
-		return fmt.Errorf("error prepping for changes")
+		root = cfg.Dst.ClientRoot
 	}
 
-	logDst.Info("Changelist %d created.", cl)
-	dstClientRoot, err := filepath.Abs(cfg.Dst.ClientRoot)
-	if err != nil {
-		logDst.Error("Unable to get absolute path for '%s': %v", cfg.Dst.ClientRoot, err)
-		return fmt.Errorf("error prepping for changes")
+	where := "waiting in"
+	if opts.Shelve {
+		where = "shelved in"
+	}
+	if len(cls) == 1 {
+		log.Warning("Success! All changes are %s CL #%d. Please review and submit when ready.", where, cls[0])
+	} else {
+		clNames := make([]string, len(cls))
+		for i, cl := range cls {
+			clNames[i] = fmt.Sprintf("#%d", cl)
+		}
+		log.Warning("Success! All changes are %s CLs %s. Please review and submit when ready.", where, strings.Join(clNames, ", "))
+	}
+
+	if len(diff.CaseMismatch) > 0 {
+		log.Error("Due to file casing problems, you will need to re-run p4harmonize after submitting the above CL.")
+		log.Error("See https://portal.perforce.com/s/article/3448 for more details.")
 	}
 
-	var pathsToDelete []string
+	log.Info("Once submitted or shelved, run 'p4harmonize cleanup' to delete workspace \"%s\"", cfg.Dst.ClientName)
+	log.Info("and local folder \"%s\"", root)
+
+	return nil
+}
+
+// buildChangelist creates (or continues) the i-th of n changelists, and opens in it the changes in diff.
+// Returns the changelist's number.
+func buildChangelist(
+	log Logger, cfg config.Config, opts Options, p4dst *p4.P4, srcRoot, dstClientRoot string,
+	copySettings CopySettings, journal *Journal, diff DepotFileDiff, i, n int,
+) (int64, error) {
+	b := &clBuilder{
+		log:           log,
+		logDst:        log.Dst(),
+		cfg:           cfg,
+		p4src:         p4.New(MakeLoggingBsh(log.Src()), cfg.Src.P4Port, cfg.Src.P4User, cfg.Src.P4Charset, cfg.Src.P4Client),
+		p4dst:         p4dst,
+		srcRoot:       srcRoot,
+		dstClientRoot: dstClientRoot,
+		copySettings:  copySettings,
+		journal:       journal,
+		opts:          opts,
+		i:             i,
+		n:             n,
+	}
+	logDst := b.logDst
+
+	cl := journal.ChangelistAt(i)
+	if cl == 0 {
+		desc, err := MakeDescription(cfg.Dst.Description, descriptionFor(journal, diff, i, n))
+		if err != nil {
+			log.Error("Unable to write changelist description: %v", err)
+			return 0, fmt.Errorf("error prepping for changes")
+		}
+
+		logDst.Info("Creating changelist in destination...")
+		cl, err = p4dst.CreateEmptyChangelist(desc)
+		if err != nil {
+			logDst.Error("Unable to create new changelist: %v", err)
+			return 0, fmt.Errorf("error prepping for changes")
+		}
+		if err := journal.SetChangelistAt(i, cl); err != nil {
+			log.Error("Unable to save journal: %v", err)
+			return 0, fmt.Errorf("error saving progress")
+		}
+		logDst.Info("Changelist %d created.", cl)
+	} else {
+		logDst.Info("Continuing with changelist %d.", cl)
+	}
+	b.cl = cl
 
 	// For each file that only exists in the destination, mark it for delete in the destination.
 	// NOTE: Process DstOnly BEFORE processing Match, so that any AppleDouble "%" files that
 	// got checked directly into the destination are cleaned up properly.
-	pathsToDelete = make([]string, 0, len(diff.DstOnly)+len(diff.CaseMismatch))
-	for _, dst := range diff.DstOnly {
-		dstPath := filepath.Join(dstClientRoot, dst.Path)
-		pathsToDelete = append(pathsToDelete, dstPath)
-	}
-	// NOTE: If the dst server is case insensitive, also delete any files with case mismatches in their paths.
-	if len(diff.CaseMismatch) > 0 {
-		log.Warning("Files with case problems detected, but the destination server is set to case insensitive mode. " +
-			"Perforce cannot fix case issues on a case insensitive server in a single pass. " +
-			"When p4harmonize completes, there will be a changelist that deletes files with " +
-			"casing issues. After that CL is submitted, please re-run p4harmonize, which will " +
-			"re-add the deleted files, but with correct casing." +
-			"See https://portal.perforce.com/s/article/3448 for more details.")
-		for _, dst := range diff.CaseMismatch {
-			dstPath := filepath.Join(dstClientRoot, dst[1].Path)
+	if !journal.IsDone(b.step(StepDelete)) {
+		pathsToDelete := make([]string, 0, len(diff.DstOnly)+len(diff.CaseMismatch))
+		for _, dst := range diff.DstOnly {
+			dstPath := filepath.Join(dstClientRoot, dst.Path)
 			pathsToDelete = append(pathsToDelete, dstPath)
 		}
+		// NOTE: If the dst server is case insensitive, also delete any files with case mismatches in their paths.
+		if len(diff.CaseMismatch) > 0 {
+			log.Warning("Files with case problems detected, but the destination server is set to case insensitive mode. " +
+				"Perforce cannot fix case issues on a case insensitive server in a single pass. " +
+				"When p4harmonize completes, there will be a changelist that deletes files with " +
+				"casing issues. After that CL is submitted, please re-run p4harmonize, which will " +
+				"re-add the deleted files, but with correct casing." +
+				"See https://portal.perforce.com/s/article/3448 for more details.")
+			for _, dst := range diff.CaseMismatch {
+				dstPath := filepath.Join(dstClientRoot, dst[1].Path)
+				pathsToDelete = append(pathsToDelete, dstPath)
+			}
+		}
+		if err := p4dst.Delete(pathsToDelete, p4.Changelist(cl)); err != nil {
+			logDst.Error("Unable to mark %d file(s) for delete: %v", len(pathsToDelete), err)
+			return 0, fmt.Errorf("error while building changelist")
+		}
+		if err := b.done(b.step(StepDelete)); err != nil {
+			return 0, err
+		}
 	}
-	if err := p4dst.Delete(pathsToDelete, p4.Changelist(cl)); err != nil {
-		logDst.Error("Unable to mark %d file(s) for delete: %w", len(pathsToDelete), err)
-		return fmt.Errorf("error while building changelist")
+
+	// If allowed, change the type of files whose contents already match directly on the server,
+	// to avoid copying them.
+	matches := diff.Match
+	if config.Enabled(cfg.Dst.RetypeInPlace) {
+		var typeOnly [][2]p4.DepotFile
+		typeOnly, matches = SplitTypeOnlyChanges(diff.Match)
+
+		for newType, diffFiles := range GroupFilePairsByType(typeOnly) {
+			retypeStep := b.step(StepFor(StepRetype, newType))
+			if journal.IsDone(retypeStep) {
+				continue
+			}
+
+			pathsToRetype := make([]string, 0, len(diffFiles))
+			for _, pair := range diffFiles {
+				pathsToRetype = append(pathsToRetype, filepath.Join(dstClientRoot, pair[1].Path))
+			}
+
+			logDst.Info("Changing type of %d file(s) to %s in place...", len(pathsToRetype), newType)
+			if err := p4dst.Retype(pathsToRetype, p4.Type(newType)); err != nil {
+				logDst.Error("Unable to retype %d file(s): %v", len(pathsToRetype), err)
+				return 0, fmt.Errorf("error while retyping files")
+			}
+			if err := b.done(retypeStep); err != nil {
+				return 0, err
+			}
+		}
 	}
 
+	// Open the files that are new or different in the source, either by copying them from the source
+	// client, or when both are on the same server, by copying them on the server.
+	if cfg.SameServer() {
+		if err := b.integrateChanges(matches, diff.SrcOnly); err != nil {
+			return 0, err
+		}
+	} else {
+		if err := b.copyChanges(matches, diff.SrcOnly); err != nil {
+			return 0, err
+		}
+	}
+
+	// TODO: Do we ALWAYS need to do this? There is a note in the digest code that suggests that
+	// sometimes digests may not be available, in which case this revert is necessary.
+	// Is that the only case? If so, can we explicitly detect that, and only do this in that case?
+	if !journal.IsDone(b.step(StepRevert)) {
+		if err := p4dst.RevertUnchanged(filepath.Join(dstClientRoot, "..."), p4.Changelist(cl)); err != nil {
+			logDst.Error("Unable to revert unchanged files in the destination: %v", err)
+			return 0, fmt.Errorf("error while building changelist")
+		}
+		if err := b.done(b.step(StepRevert)); err != nil {
+			return 0, err
+		}
+	}
+
+	// Shelve the changes so they can be reviewed from anywhere, then revert them from the client without
+	// touching the local files, so the client can be deleted right away.
+	if opts.Shelve && !journal.IsDone(b.step(StepShelve)) {
+		logDst.Info("Shelving changelist %d...", cl)
+		if err := p4dst.Shelve(cl); err != nil {
+			logDst.Error("Unable to shelve changelist %d: %v", cl, err)
+			return 0, fmt.Errorf("error shelving changelist")
+		}
+		if err := p4dst.Revert(filepath.Join(dstClientRoot, "..."), p4.Changelist(cl), p4.Keep); err != nil {
+			logDst.Error("Unable to revert shelved files in the destination: %v", err)
+			return 0, fmt.Errorf("error shelving changelist")
+		}
+		if err := b.done(b.step(StepShelve)); err != nil {
+			return 0, err
+		}
+	}
+
+	return cl, nil
+}
+
+// clBuilder holds what is needed to open changes in one of the changelists being built.
+type clBuilder struct {
+	log           Logger
+	logDst        Logger
+	cfg           config.Config
+	p4src         *p4.P4
+	p4dst         *p4.P4
+	srcRoot       string
+	dstClientRoot string
+	copySettings  CopySettings
+	journal       *Journal
+	opts          Options
+	cl            int64
+	i, n          int // this is the i-th of n changelists
+}
+
+// step returns the name of the given step for this changelist.
+func (b *clBuilder) step(name string) string {
+	if b.n == 1 {
+		return name
+	}
+	return StepForChangelist(b.i, name)
+}
+
+// done records a completed step in the journal.
+func (b *clBuilder) done(step string) error {
+	if err := b.journal.Done(step); err != nil {
+		b.log.Error("Unable to save journal: %v", err)
+		return fmt.Errorf("error saving progress")
+	}
+	return nil
+}
+
+// fetch writes the content of the job's source file to its DstPath, in the destination client's root. The file
+// is either copied from the source client's root, or printed from the source server, depending on the config.
+// If the config says to verify copies, the new file's digest is then checked against the source's.
+func (b *clBuilder) fetch(job copyJob) error {
+	if err := b.fetchContent(job); err != nil {
+		return err
+	}
+	if config.Enabled(b.cfg.Dst.VerifyCopies) {
+		return VerifyDigest(job.DstPath, job.Src, b.copySettings.lineEndingOf(job.Src.Type))
+	}
+	return nil
+}
+
+func (b *clBuilder) fetchContent(job copyJob) error {
+	src, dstPath := job.Src, job.DstPath
+	if b.cfg.Src.Fetch != config.FetchPrint {
+		settings := b.copySettings
+		if job.Edit {
+			settings = settings.withoutHardlinks()
+		}
+		return PerforceFileCopy(filepath.Join(b.srcRoot, src.Path), dstPath, src.Type, settings)
+	}
+
+	localPath, err := p4.UnescapePath(dstPath)
+	if err != nil {
+		return err
+	}
+	srcPath := fmt.Sprintf("//%s/%s%s", b.p4src.Client, src.Path, b.journal.Plan.Src.ContentRevision())
+	if err := b.p4src.PrintToFile(srcPath, localPath); err != nil {
+		return fmt.Errorf("error printing '%s' to '%s': %w", srcPath, localPath, err)
+	}
+
+	// unicode files are printed in the source client's charset
+	convert, err := b.copySettings.conversionFor(src.Type)
+	if err != nil {
+		return fmt.Errorf("unable to copy '%s': %w", srcPath, err)
+	}
+	if convert != nil {
+		if err := convertFile(localPath, localPath, convert); err != nil {
+			return err
+		}
+	}
+
+	// printing a symlink just writes out its target, so replace that with an actual symlink
+	if isSymlinkType(src.Type) {
+		target, err := os.ReadFile(localPath)
+		if err != nil {
+			return fmt.Errorf("unable to read '%s': %w", localPath, err)
+		}
+		return makeSymlink(strings.TrimRight(string(target), "\r\n"), localPath)
+	}
+
+	return applyTypeModifiers(localPath, src.Type, func() (time.Time, error) {
+		return b.p4src.ModTime(srcPath)
+	})
+}
+
+// copyJob is a single file to fetch from the source into the destination client's root.
+type copyJob struct {
+	Src     p4.DepotFile
+	DstPath string
+	Edit    bool // the file will be opened for edit, which makes it writable, so it mustn't be hardlinked
+}
+
+// fetchAll fetches the file for each job (see fetch), running up to opts.CopyWorkers fetches at the same time.
+// Every job is attempted, even after some fail, and each failure is logged.
+func (b *clBuilder) fetchAll(jobs []copyJob) error {
+	errs := RunWorkers(len(jobs), b.opts.CopyWorkers, func(i int) error {
+		return b.fetch(jobs[i])
+	})
+	for _, err := range errs {
+		b.logDst.Error("%v", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d file(s) failed to copy", len(errs), len(jobs))
+	}
+	return nil
+}
+
+// copyChanges copies each file in matches and srcOnly from the source (see fetch) to the destination
+// client's root, then opens it for edit (and move, if the case of its path changed), or for add.
+func (b *clBuilder) copyChanges(matches [][2]p4.DepotFile, srcOnly []p4.DepotFile) error {
+	logDst, p4dst, cl := b.logDst, b.p4dst, b.cl
+	dstClientRoot := b.dstClientRoot
+
 	// For each file with the capitalization or the types different, copy the file, then make
 	// sure perforce is set to fix the mismatch(es).
-	matchFilePairsByType := GroupFilePairsByType(diff.Match)
+	matchFilePairsByType := GroupFilePairsByType(matches)
 
 	for newType, diffFiles := range matchFilePairsByType {
+		editStep := b.step(StepFor(StepEdit, newType))
+		if b.journal.IsDone(editStep) {
+			continue
+		}
+
+		var jobs []copyJob
+		var moves [][2]p4.DepotFile
 		var pathsToEdit []string
 
 		for _, pair := range diffFiles {
-			srcPath := filepath.Join(srcRes.ClientRoot, pair[0].Path)
 			dstPathNew := filepath.Join(dstClientRoot, pair[0].Path)
 			dstPathOld := filepath.Join(dstClientRoot, pair[1].Path)
 
-			// copy file from source root to destination root
-			if err := PerforceFileCopy(srcPath, dstPathOld, pair[0].Type); err != nil {
-				logDst.Error("%v", err)
-				return fmt.Errorf("error while building changelist")
-			}
-
 			if dstPathOld != dstPathNew {
-				// path has changed, do a single file edit and move
-				if err := p4dst.Edit([]string{dstPathOld}, p4.Changelist(cl), p4.Type(newType)); err != nil {
-					logDst.Error("Unable to open '%s' for edit: %w", dstPathOld, err)
-					return fmt.Errorf("error while building changelist")
-				}
-				if err := p4dst.Move(dstPathOld, dstPathNew, p4.Changelist(cl), p4.Type(newType)); err != nil {
-					logDst.Error("Unable to open '%s' for move to '%s': %v", dstPathOld, dstPathNew, err)
-					return fmt.Errorf("error while building changelist")
+				if b.journal.IsDone(b.step(StepFor(StepMove, pair[1].Path))) {
+					continue
 				}
+				// path has changed, so it will need a single file edit and move
+				moves = append(moves, pair)
 			} else {
 				// add to array for batch edit
 				pathsToEdit = append(pathsToEdit, dstPathOld)
 			}
+
+			// copy file from source to destination root
+			jobs = append(jobs, copyJob{pair[0], dstPathOld, true})
+		}
+
+		if err := b.fetchAll(jobs); err != nil {
+			logDst.Error("%v", err)
+			return fmt.Errorf("error while building changelist")
+		}
+
+		for _, pair := range moves {
+			dstPathNew := filepath.Join(dstClientRoot, pair[0].Path)
+			dstPathOld := filepath.Join(dstClientRoot, pair[1].Path)
+			if err := p4dst.Edit([]string{dstPathOld}, p4.Changelist(cl), p4.Type(newType)); err != nil {
+				logDst.Error("Unable to open '%s' for edit: %v", dstPathOld, err)
+				return fmt.Errorf("error while building changelist")
+			}
+			if err := p4dst.Move(dstPathOld, dstPathNew, p4.Changelist(cl), p4.Type(newType)); err != nil {
+				logDst.Error("Unable to open '%s' for move to '%s': %v", dstPathOld, dstPathNew, err)
+				return fmt.Errorf("error while building changelist")
+			}
+			if err := b.done(b.step(StepFor(StepMove, pair[1].Path))); err != nil {
+				return err
+			}
 		}
 
 		// mark files in destination for edit with type
@@ -205,163 +588,432 @@ func Harmonize(log Logger, cfg config.Config) error {
 			logDst.Error("Unable to open %d file(s) for edit: %v", len(pathsToEdit), err)
 			return fmt.Errorf("error while building changelist")
 		}
+		if err := b.done(editStep); err != nil {
+			return err
+		}
 	}
 
 	// For each file that only exists in the source, copy it over then add it to the destination.
-	srcOnlyFilesByType := GroupFilesByType(diff.SrcOnly)
+	srcOnlyFilesByType := GroupFilesByType(srcOnly)
 
 	for srcType, srcFiles := range srcOnlyFilesByType {
-		var pathsToAdd []string
+		addStep := b.step(StepFor(StepAdd, srcType))
+		if b.journal.IsDone(addStep) {
+			continue
+		}
+
+		jobs := make([]copyJob, 0, len(srcFiles))
+		pathsToAdd := make([]string, 0, len(srcFiles))
 
 		for _, src := range srcFiles {
-			srcPath := filepath.Join(srcRes.ClientRoot, src.Path)
 			dstPath := filepath.Join(dstClientRoot, src.Path)
 
-			// copy file from source root to destination root
-			if err := PerforceFileCopy(srcPath, dstPath, src.Type); err != nil {
-				logDst.Error("%v", err)
-				return fmt.Errorf("error while building changelist")
-			}
+			// copy file from source to destination root
+			jobs = append(jobs, copyJob{src, dstPath, false})
 
 			// add to the depot
 			dstPathForAdd, err := p4.UnescapePath(dstPath)
 			if err != nil {
-				logDst.Error("Error unescaping '%s': %w", dstPath, err)
+				logDst.Error("Error unescaping '%s': %v", dstPath, err)
 				return fmt.Errorf("error while building changelist")
 			}
 
 			pathsToAdd = append(pathsToAdd, dstPathForAdd)
 		}
 
+		if err := b.fetchAll(jobs); err != nil {
+			logDst.Error("%v", err)
+			return fmt.Errorf("error while building changelist")
+		}
+
 		if err := p4dst.Add(pathsToAdd, p4.Changelist(cl), p4.Type(srcType), p4.DoNotIgnore); err != nil {
-			logDst.Error("Unable to open %d file(s) for add: %w", len(pathsToAdd), err)
+			logDst.Error("Unable to open %d file(s) for add: %v", len(pathsToAdd), err)
 			return fmt.Errorf("error while building changelist")
 		}
+		if err := b.done(addStep); err != nil {
+			return err
+		}
 	}
 
-	// TODO: Do we ALWAYS need to do this? There is a note in the digest code that suggests that
-	// sometimes digests may not be available, in which case this revert is necessary.
-	// Is that the only case? If so, can we explicitly detect that, and only do this in that case?
-	if err := p4dst.RevertUnchanged(filepath.Join(dstClientRoot, "..."), p4.Changelist(cl)); err != nil {
-		logDst.Error("Unable to revert unchanged files in the destination: %w", err)
-		return fmt.Errorf("error while building changelist")
-	}
+	return nil
+}
 
-	root, err := filepath.Abs(cfg.Dst.ClientRoot)
-	if err != nil {
-		root = cfg.Dst.ClientRoot
+// submitCaseFixes creates and submits a changelist that deletes each destination file in the journal's
+// CaseMismatch list, then updates the journal's plan so those files will be added back with the correct case.
+func submitCaseFixes(log Logger, p4dst *p4.P4, dstClientRoot string, journal *Journal) error {
+	logDst := log.Dst()
+	mismatches := journal.Plan.Diff.CaseMismatch
+
+	cl := journal.CaseFixChangelist
+	if cl == 0 {
+		logDst.Info("Creating changelist to delete %d file(s) with mismatched case...", len(mismatches))
+		var err error
+		cl, err = p4dst.CreateEmptyChangelist(fmt.Sprintf(
+			"p4harmonize: delete %d file(s) with mismatched case, so they can be re-added with the correct case",
+			len(mismatches),
+		))
+		if err != nil {
+			logDst.Error("Unable to create new changelist: %v", err)
+			return fmt.Errorf("error fixing case mismatches")
+		}
+		if err := journal.SetCaseFixChangelist(cl); err != nil {
+			log.Error("Unable to save journal: %v", err)
+			return fmt.Errorf("error saving progress")
+		}
 	}
 
-	log.Warning("Success! All changes are waiting in CL #%d. Please review and submit when ready.", cl)
-
-	if len(diff.CaseMismatch) > 0 {
-		log.Error("Due to file casing problems, you will need to re-run p4harmonize after submitting the above CL.")
-		log.Error("See https://portal.perforce.com/s/article/3448 for more details.")
+	pathsToDelete := make([]string, 0, len(mismatches))
+	for _, pair := range mismatches {
+		pathsToDelete = append(pathsToDelete, filepath.Join(dstClientRoot, pair[1].Path))
+	}
+	if err := p4dst.Delete(pathsToDelete, p4.Changelist(cl)); err != nil {
+		logDst.Error("Unable to mark %d file(s) for delete: %v", len(pathsToDelete), err)
+		return fmt.Errorf("error fixing case mismatches")
 	}
 
-	log.Info("Remember to delete workspace \"%s\"", cfg.Dst.ClientName)
-	log.Info("and local folder \"%s\"", root)
-
+	logDst.Info("Submitting changelist %d...", cl)
+	submitted, err := p4dst.SubmitChangelist(cl)
+	if err != nil {
+		logDst.Error("Unable to submit changelist %d: %v", cl, err)
+		return fmt.Errorf("error fixing case mismatches")
+	}
+	log.Warning("Submitted change %d, which deletes %d file(s) with mismatched case.", submitted, len(mismatches))
+
+	journal.CaseFixChangelist = submitted
+	journal.Plan.Dst.Change = submitted
+	journal.Plan.Diff = journal.Plan.Diff.WithCaseMismatchesDeleted()
+	if err := journal.Done(StepCaseFix); err != nil {
+		log.Error("Unable to save journal: %v", err)
+		return fmt.Errorf("error saving progress")
+	}
 	return nil
 }
 
 // preFlightChecks performs quick checks to ensure we're in a good state, before
 // doing any action that might take a while to complete.
 func preFlightChecks(log Logger, cfg config.Config) bool {
-
-	// verify we're logged in to both src and dst
-
-	logSrc := log.Src()
-	shSrc := MakeLoggingBsh(logSrc)
-	p4src := p4.New(shSrc, cfg.Src.P4Port, cfg.Src.P4User, cfg.Src.P4Charset, "")
-
-	if needsLogin, err := p4src.NeedsLogin(); err != nil {
-		logSrc.Error("Error checking login status on %s: %v", p4src.Port, err)
-		return false
-	} else if needsLogin {
-		logSrc.Error("Not logged in. Please run 'p4 -p %s -u %s login' and then try again.", p4src.Port, p4src.User)
+	if !checkLogins(log, cfg) {
 		return false
 	}
 
-	logDst := log.Dst()
-	shDst := MakeLoggingBsh(logDst)
-	p4dst := p4.New(shDst, cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, "")
+	// verify there isn't an unfinished run waiting to be resumed
 
-	if needsLogin, err := p4dst.NeedsLogin(); err != nil {
-		logDst.Error("Error checking login status on %s: %v", p4dst.Port, err)
-		return false
-	} else if needsLogin {
-		logDst.Error("Not logged in. Please run 'p4 -p %s -u %s login' and then try again.", p4dst.Port, p4dst.User)
+	if _, err := os.Stat(JournalPath(cfg)); err == nil {
+		log.Error("Found journal '%s' from a run that did not finish.", JournalPath(cfg))
+		log.Error("Please run again with --resume to finish it, or delete the journal (and the client and client root it created) to start over.")
 		return false
 	}
 
 	// verify destination folders and clients we want to create don't already exist
 
+	logDst := log.Dst()
+	shDst := MakeLoggingBsh(logDst)
+	p4dst := p4.New(shDst, cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, "")
+
 	if shDst.Exists(cfg.Dst.ClientRoot) {
 		logDst.Error("Destination client root '%s' already exists.", cfg.Dst.ClientRoot)
 		logDst.Error("Please delete it, or change `destination.new_client_root` in your config file, then try again.")
 		return false
 	}
 
-	clients, err := p4dst.ListClients()
+	exists, err := hasClient(p4dst, cfg.Dst.ClientName)
 	if err != nil {
 		logDst.Error("Failed to get clients from %s: %v", cfg.Dst.P4Port, err)
 		return false
 	}
 
-	hasClient := false
+	if exists {
+		logDst.Error("Destination client %s already exists on %s.", cfg.Dst.ClientName, cfg.Dst.P4Port)
+		logDst.Error("Please delete it, or change `destination.new_client_name` in your config file, then try again.")
+		return false
+	}
+
+	return true
+}
+
+// hasClient returns true if the current user has a client with the given name.
+func hasClient(p *p4.P4, name string) (bool, error) {
+	clients, err := p.ListClients()
+	if err != nil {
+		return false, err
+	}
 	for _, client := range clients {
-		if client == cfg.Dst.ClientName {
-			hasClient = true
-			break
+		if client == name {
+			return true, nil
 		}
 	}
+	return false, nil
+}
 
-	if hasClient {
-		logDst.Error("Destination client %s already exists on %s.", cfg.Dst.ClientName, cfg.Dst.P4Port)
-		logDst.Error("Please delete it, or change `destination.new_client_name` in your config file, then try again.")
+// checkLogins ensures we have a valid ticket on both the source and destination servers.
+func checkLogins(log Logger, cfg config.Config) bool {
+	logSrc := log.Src()
+	p4src := p4.New(MakeLoggingBsh(logSrc), cfg.Src.P4Port, cfg.Src.P4User, cfg.Src.P4Charset, "")
+	if !checkLogin(logSrc, p4src) {
 		return false
 	}
 
+	logDst := log.Dst()
+	p4dst := p4.New(MakeLoggingBsh(logDst), cfg.Dst.P4Port, cfg.Dst.P4User, cfg.Dst.P4Charset, "")
+	return checkLogin(logDst, p4dst)
+}
+
+// checkLogin ensures we have a valid ticket on the given server.
+func checkLogin(log Logger, p *p4.P4) bool {
+	if needsLogin, err := p.NeedsLogin(); err != nil {
+		log.Error("Error checking login status on %s: %v", p.Port, err)
+		return false
+	} else if needsLogin {
+		log.Error("Not logged in. Please run 'p4 -p %s -u %s login' and then try again.", p.Port, p.User)
+		return false
+	}
 	return true
 }
 
-// srcSyncAndList connects to the source perforce server, syncs to head, then
-// requests a list of all file names and types.
-func srcSyncAndList(logSrc Logger, shSrc *bsh.Bsh, cfg config.Config) srcThreadResults {
+// copySettingsFor works out how files should be copied from the source client's root to the destination's,
+// given the config, and each client and server.
+func copySettingsFor(log Logger, cfg config.Config, p4dst *p4.P4) (CopySettings, bool) {
+	settings := CopySettings{Strategy: cfg.Dst.CopyStrategy}
+	if cfg.SameServer() {
+		// files are copied on the server
+		return settings, true
+	}
+
+	logSrc, logDst := log.Src(), log.Dst()
+	p4src := p4.New(MakeLoggingBsh(logSrc), cfg.Src.P4Port, cfg.Src.P4User, cfg.Src.P4Charset, cfg.Src.P4Client)
+	var err error
+
+	// unicode files in each client's root are in that client's charset (if its server is in unicode mode)
+	if settings.SrcCharset, err = unicodeCharset(p4src); err != nil {
+		logSrc.Error("Failed getting info from server %s: %v", p4src.DisplayName(), err)
+		return CopySettings{}, false
+	}
+	if settings.DstCharset, err = unicodeCharset(p4dst); err != nil {
+		logDst.Error("Failed getting info from server %s: %v", p4dst.DisplayName(), err)
+		return CopySettings{}, false
+	}
+	if len(settings.SrcCharset) > 0 && len(settings.DstCharset) > 0 && settings.SrcCharset != settings.DstCharset {
+		log.Info("Converting unicode files from charset '%s' to '%s' while copying.", settings.SrcCharset, settings.DstCharset)
+	}
+
+	// text files in each client's root have that client's line endings (printed files are left as-is)
+	if cfg.SyncsSource() {
+		if settings.SrcLineEnding, err = clientLineEnding(p4src, runtime.GOOS); err != nil {
+			logSrc.Error("Unable to get line endings of client %s: %v", p4src.Client, err)
+			return CopySettings{}, false
+		}
+		if settings.DstLineEnding, err = clientLineEnding(p4dst, runtime.GOOS); err != nil {
+			logDst.Error("Unable to get line endings of client %s: %v", p4dst.Client, err)
+			return CopySettings{}, false
+		}
+		if settings.SrcLineEnding != settings.DstLineEnding {
+			log.Info("Converting line endings of text files from %s to %s while copying.",
+				describeLineEnding(settings.SrcLineEnding), describeLineEnding(settings.DstLineEnding))
+		}
+	}
+
+	return settings, true
+}
+
+// srcList connects to the source perforce server, then requests a list of all file names and types at
+// the configured revision (pinned to the latest change, if that is #head; see contentRevision).
+func srcList(logSrc Logger, shSrc *bsh.Bsh, cfg config.Config) srcThreadResults {
 	p4src := p4.New(shSrc, cfg.Src.P4Port, cfg.Src.P4User, cfg.Src.P4Charset, cfg.Src.P4Client)
 
-	spec, err := p4src.GetClientSpec()
+	_, stream, err := srcClientInfo(p4src)
 	if err != nil {
-		logSrc.Error("Failed to get client spec: %v", err)
+		logSrc.Error("%v", err)
 		return srcThreadResults{Success: false}
 	}
-	root, exists := spec["Root"]
-	if !exists {
-		logSrc.Error("Missing field `Root` in client spec %s", p4src.Client)
+
+	info, err := p4src.Info()
+	if err != nil {
+		logSrc.Error("Failed getting info from server %s: %v", p4src.DisplayName(), err)
 		return srcThreadResults{Success: false}
 	}
 
-	logSrc.Info("Getting latest from source...")
-
-	if err := p4src.SyncLatest(); err != nil {
-		logSrc.Error("Failed to sync latest: %v", err)
+	// grab the change first, then list at that change (when the revision is #head), so that the listing
+	// matches what is later synced or printed, even if more changes are submitted while we work
+	change, err := p4src.LatestChange(fmt.Sprintf("//%s/...%s", p4src.Client, cfg.Src.RevisionOrHead()))
+	if err != nil {
+		logSrc.Error("Failed to get latest change: %v", err)
 		return srcThreadResults{Success: false}
 	}
+	revision := contentRevision(cfg.Src.Revision, change)
 
-	logSrc.Info("Downloading list of files with types from source...")
+	logSrc.Info("Downloading list of files with types from source at %s...", revision)
 
-	files, err := p4src.ListDepotFiles()
+	files, err := p4src.ListDepotFilesAt(revision)
 	if err != nil {
 		logSrc.Error("Failed to list files from source: %v", err)
 		return srcThreadResults{Success: false}
 	}
 
+	var engineVersion string
+	if usesEngineVersion(cfg.Dst.Description) {
+		engineVersion = srcEngineVersion(logSrc, p4src, revision)
+	}
+
 	return srcThreadResults{
-		Success:    true,
-		ClientRoot: root,
-		Files:      files,
+		Success:       true,
+		Stream:        stream,
+		Unicode:       info.Unicode,
+		Change:        change,
+		EngineVersion: engineVersion,
+		Files:         files,
+	}
+}
+
+// srcEngineVersion prints the Unreal Engine version file (see EngineVersionPath) from the source at the given
+// revision, and returns the version it holds. If the version can't be read, a warning is logged, and an empty
+// string is returned.
+func srcEngineVersion(logSrc Logger, p4src *p4.P4, revision string) string {
+	path := fmt.Sprintf("//%s/%s%s", p4src.Client, EngineVersionPath, revision)
+	contents, err := p4src.Print(path)
+	if err == nil && len(contents) == 0 {
+		err = fmt.Errorf("no such file")
+	}
+	var version string
+	if err == nil {
+		version, err = ParseEngineVersion(contents)
+	}
+	if err != nil {
+		logSrc.Warning("Unable to read the engine version from %s, so it will be left out of the description: %v", path, err)
+	}
+	return version
+}
+
+// srcSync connects to the source perforce server and syncs the files whose content is needed to apply the
+// plan (or the whole client, if source.full_sync is set) to the revision the plan was made at, returning the
+// client root.
+// If source.workspace_check is set, those files are then checked for local changes (see srcCheckWorkspace).
+// Nothing is synced if the config gets files without syncing (see config.SyncsSource).
+func srcSync(logSrc Logger, cfg config.Config, plan Plan) (string, bool) {
+	p4src := p4.New(MakeLoggingBsh(logSrc), cfg.Src.P4Port, cfg.Src.P4User, cfg.Src.P4Charset, cfg.Src.P4Client)
+
+	root, _, err := srcClientInfo(p4src)
+	if err != nil {
+		logSrc.Error("%v", err)
+		return "", false
+	}
+
+	if !cfg.SyncsSource() {
+		logSrc.Info("Files will be copied without syncing the source client.")
+		return root, true
+	}
+
+	revision := plan.Src.ContentRevision()
+	files := FilesToCopy(cfg, plan.Diff)
+
+	if config.Enabled(cfg.Src.FullSync) {
+		logSrc.Info("Syncing source to %s...", revision)
+		if err := p4src.SyncTo(revision); err != nil {
+			logSrc.Error("Failed to sync to %s: %v", revision, err)
+			return "", false
+		}
+	} else {
+		paths := make([]string, 0, len(files))
+		for _, f := range files {
+			paths = append(paths, fmt.Sprintf("//%s/%s%s", p4src.Client, f.Path, revision))
+		}
+
+		logSrc.Info("Syncing %d source file(s) to %s...", len(files), revision)
+		if err := p4src.SyncFiles(paths); err != nil {
+			logSrc.Error("Failed to sync files to %s: %v", revision, err)
+			return "", false
+		}
+	}
+
+	if len(cfg.Src.WorkspaceCheck) > 0 && !srcCheckWorkspace(logSrc, p4src, cfg, files, revision) {
+		return "", false
 	}
+
+	return root, true
+}
+
+// srcCheckWorkspace looks for any of the passed files that were changed or deleted in the source client's root
+// without being checked out, then either reports them and fails, or force syncs them to revision, depending on
+// the config.
+func srcCheckWorkspace(logSrc Logger, p4src *p4.P4, cfg config.Config, files []p4.DepotFile, revision string) bool {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, fmt.Sprintf("//%s/%s", p4src.Client, f.Path))
+	}
+
+	logSrc.Info("Checking %d source file(s) for local changes...", len(paths))
+	changed, err := p4src.ChangedInWorkspace(paths)
+	if err != nil {
+		logSrc.Error("Failed to check for local changes: %v", err)
+		return false
+	}
+	if len(changed) == 0 {
+		return true
+	}
+
+	if cfg.Src.WorkspaceCheck == config.WorkspaceCheckAbort {
+		logSrc.Error("%d source file(s) were changed or deleted without being checked out:", len(changed))
+		for _, path := range changed {
+			logSrc.Error("  %s", path)
+		}
+		logSrc.Error("Please run 'p4 clean' on these files, or set `source.workspace_check` to '%s'.", config.WorkspaceCheckResync)
+		return false
+	}
+
+	logSrc.Warning("Force syncing %d source file(s) that were changed or deleted without being checked out...", len(changed))
+	resync := make([]string, 0, len(changed))
+	for _, path := range changed {
+		resync = append(resync, path+revision)
+	}
+	if err := p4src.SyncFiles(resync, p4.Force); err != nil {
+		logSrc.Error("Failed to force sync files to %s: %v", revision, err)
+		return false
+	}
+
+	stillChanged, err := p4src.ChangedInWorkspace(changed)
+	if err != nil {
+		logSrc.Error("Failed to check for local changes: %v", err)
+		return false
+	}
+	if len(stillChanged) > 0 {
+		logSrc.Error("%d source file(s) still don't match the depot after a force sync, including: %s", len(stillChanged), stillChanged[0])
+		return false
+	}
+	return true
+}
+
+// FilesToCopy returns the source files whose content is copied into the destination when applying diff.
+func FilesToCopy(cfg config.Config, diff DepotFileDiff) []p4.DepotFile {
+	matches := diff.Match
+	if config.Enabled(cfg.Dst.RetypeInPlace) {
+		// files that only changed type are retyped on the server, without copying their content
+		_, matches = SplitTypeOnlyChanges(matches)
+	}
+
+	out := make([]p4.DepotFile, 0, len(matches)+len(diff.SrcOnly)+len(diff.CaseMismatch))
+	for _, pair := range matches {
+		out = append(out, pair[0])
+	}
+	out = append(out, diff.SrcOnly...)
+	if config.Enabled(cfg.Dst.SubmitCaseFixes) {
+		// mismatched files are deleted, then re-added from the source with the correct case
+		for _, pair := range diff.CaseMismatch {
+			out = append(out, pair[0])
+		}
+	}
+	return out
+}
+
+// srcClientInfo returns the root and stream from the source client's spec.
+func srcClientInfo(p4src *p4.P4) (root string, stream string, err error) {
+	spec, err := p4src.GetClientSpec()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get client spec: %w", err)
+	}
+	root, exists := spec["Root"]
+	if !exists {
+		return "", "", fmt.Errorf("missing field `Root` in client spec %s", p4src.Client)
+	}
+	return root, spec["Stream"], nil
 }
 
 func MakeLoggingBsh(log Logger) *bsh.Bsh {
@@ -378,14 +1030,14 @@ func MakeLoggingBsh(log Logger) *bsh.Bsh {
 }
 
 type DepotFileDiff struct {
-	Match   [][2]p4.DepotFile // Paths match, but type, case, or content may not (see CaseMismatch below for exceptions).
-	SrcOnly []p4.DepotFile    // Path only exists in source
-	DstOnly []p4.DepotFile    // Path only exists in destination
+	Match   [][2]p4.DepotFile `json:"match"`    // Paths match, but type, case, or content may not (see CaseMismatch below for exceptions).
+	SrcOnly []p4.DepotFile    `json:"src_only"` // Path only exists in source
+	DstOnly []p4.DepotFile    `json:"dst_only"` // Path only exists in destination
 
 	// When the dst server is in case insensitive mode, any case mismatches must be handled specially.
 	// In this case, Match will not list files that have case mismatches in their path, and instead
 	// those files will only be listed here in CaseMismatch.
-	CaseMismatch [][2]p4.DepotFile
+	CaseMismatch [][2]p4.DepotFile `json:"case_mismatch,omitempty"`
 }
 
 // HasDifference returns true if this struct contains any differences at all
@@ -393,6 +1045,22 @@ func (d *DepotFileDiff) HasDifference() bool {
 	return len(d.Match) > 0 || len(d.SrcOnly) > 0 || len(d.DstOnly) > 0 || len(d.CaseMismatch) > 0
 }
 
+// WithCaseMismatchesDeleted returns a copy of this diff for after the destination files in CaseMismatch have
+// been deleted, which means their source files now just need to be added.
+func (d *DepotFileDiff) WithCaseMismatchesDeleted() DepotFileDiff {
+	out := DepotFileDiff{
+		Match:   d.Match,
+		SrcOnly: make([]p4.DepotFile, 0, len(d.SrcOnly)+len(d.CaseMismatch)),
+		DstOnly: d.DstOnly,
+	}
+	out.SrcOnly = append(out.SrcOnly, d.SrcOnly...)
+	for _, pair := range d.CaseMismatch {
+		out.SrcOnly = append(out.SrcOnly, pair[0])
+	}
+	sort.Sort(p4.DepotFileCaseInsensitive(out.SrcOnly))
+	return out
+}
+
 type ReconcileOption uint8
 
 const (
@@ -438,7 +1106,8 @@ func Reconcile(src []p4.DepotFile, dst []p4.DepotFile, opts ...ReconcileOption)
 				// run a second pass to get it re-added with the proper case.
 				// So we don't need to know anything else about this file right now.
 			} else {
-				typeDifference := src[is].Type != dst[id].Type
+				// Compare types by what they mean, not how they're spelled, ie "ktext" is the same as "text+k".
+				typeDifference := !p4.SameFileType(src[is].Type, dst[id].Type)
 				// If we don't have a digest, assume it's different (since we'll use `p4 revert -a` to
 				// cleanup at the end), otherwise compare digests to see if there's a difference.
 				contentDifference := len(src[is].Digest) == 0 || src[is].Digest != dst[id].Digest
@@ -468,67 +1137,6 @@ func Reconcile(src []p4.DepotFile, dst []p4.DepotFile, opts ...ReconcileOption)
 	return out
 }
 
-// PerforceFileCopy copies file "src" to file/path "dst", creating any missing directories needed by "dst",
-// and handling Perforce escape characters (%00) properly.
-func PerforceFileCopy(src, dst, filetype string) error {
-	srcPath, err := p4.UnescapePath(src)
-	if err != nil {
-		return err
-	}
-	dstPath, err := p4.UnescapePath(dst)
-	if err != nil {
-		return err
-	}
-
-	switch filetype {
-	case "apple":
-		srcDouble := filepath.Join(filepath.Dir(srcPath), "%"+filepath.Base(srcPath))
-		dstDouble := filepath.Join(filepath.Dir(dstPath), "%"+filepath.Base(dstPath))
-		if err := verifyAndCopy(srcDouble, dstDouble); err != nil {
-			return err
-		}
-	}
-
-	return verifyAndCopy(srcPath, dstPath)
-}
-
-func verifyAndCopy(srcPath, dstPath string) error {
-	srcInfo, err := os.Stat(srcPath)
-	if err != nil {
-		return fmt.Errorf("unable to stat '%s': %w", srcPath, err)
-	}
-
-	if !srcInfo.Mode().IsRegular() {
-		return fmt.Errorf("'%s' is not a regular file", srcPath)
-	}
-	srcSize := srcInfo.Size()
-
-	dstDir := filepath.Dir(dstPath)
-	if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
-		return fmt.Errorf("unable to mkdir '%s': %w", dstDir, err)
-	}
-
-	s, err := os.Open(srcPath)
-	if err != nil {
-		return fmt.Errorf("unable to open '%s': %w", srcPath, err)
-	}
-	defer s.Close()
-
-	d, err := os.Create(dstPath)
-	if err != nil {
-		return fmt.Errorf("unable to create '%s': %w", dstPath, err)
-	}
-	defer d.Close()
-	n, err := io.Copy(d, s)
-	if err != nil {
-		return fmt.Errorf("unable to copy '%s' to '%s': %w", srcPath, dstPath, err)
-	}
-	if n != srcSize {
-		return fmt.Errorf("expected '%s' to copy %d bytes to '%s', but only %d were copied", srcPath, n, dstPath, srcSize)
-	}
-	return nil
-}
-
 // Splits a list of files into groups of files in which each group
 // shares the same perforce file type
 func GroupFilesByType(files []p4.DepotFile) map[string][]p4.DepotFile {
@@ -552,3 +1160,16 @@ func GroupFilePairsByType(filePairs [][2]p4.DepotFile) map[string][][2]p4.DepotF
 
 	return filePairsByType
 }
+
+// SplitTypeOnlyChanges separates out the pairs of files that differ only in their type (same path, same
+// digest), and so could have their type changed on the server without transferring any file content.
+func SplitTypeOnlyChanges(filePairs [][2]p4.DepotFile) (typeOnly, rest [][2]p4.DepotFile) {
+	for _, pair := range filePairs {
+		if pair[0].Path == pair[1].Path && !hasContentDifference(pair) && hasTypeDifference(pair) {
+			typeOnly = append(typeOnly, pair)
+		} else {
+			rest = append(rest, pair)
+		}
+	}
+	return typeOnly, rest
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/danbrakeley/p4harmonize/internal/config"
 	"github.com/danbrakeley/p4harmonize/internal/p4"
 )
 
@@ -179,3 +180,88 @@ func checkReconcileWithExpected(t *testing.T, actual DepotFileDiff, expected Exp
 		t.Errorf("expected %s, got %s", expected.CaseMismatch, actualCaseMismatch)
 	}
 }
+
+func Test_ReconcileEquivalentTypes(t *testing.T) {
+	src := []p4.DepotFile{
+		{Path: "a", Type: "ktext", Digest: "d1"},
+		{Path: "b", Type: "xbinary", Digest: "d1"},
+		{Path: "c", Type: "binary+lS", Digest: "d1"},
+		{Path: "d", Type: "binary+l", Digest: "d1"},
+	}
+	dst := []p4.DepotFile{
+		{Path: "a", Type: "text+k", Digest: "d1"},
+		{Path: "b", Type: "binary+x", Digest: "d1"},
+		{Path: "c", Type: "binary+Sl", Digest: "d1"},
+		{Path: "d", Type: "binary+S", Digest: "d1"},
+	}
+
+	diff := Reconcile(src, dst)
+	checkReconcileWithExpected(t, diff, Expected{"d:d", "", "", ""})
+}
+
+func Test_SplitTypeOnlyChanges(t *testing.T) {
+	pair := func(src, dst p4.DepotFile) [2]p4.DepotFile { return [2]p4.DepotFile{src, dst} }
+	pairs := [][2]p4.DepotFile{
+		pair(p4.DepotFile{Path: "a", Type: "binary+l", Digest: "d1"}, p4.DepotFile{Path: "a", Type: "binary", Digest: "d1"}),
+		pair(p4.DepotFile{Path: "b", Type: "binary+l", Digest: "d1"}, p4.DepotFile{Path: "b", Type: "binary", Digest: "d2"}),
+		pair(p4.DepotFile{Path: "c", Type: "binary+l"}, p4.DepotFile{Path: "c", Type: "binary"}),
+		pair(p4.DepotFile{Path: "d", Type: "binary+l", Digest: "d1"}, p4.DepotFile{Path: "D", Type: "binary", Digest: "d1"}),
+		pair(p4.DepotFile{Path: "e", Type: "text", Digest: "d1"}, p4.DepotFile{Path: "e", Type: "text", Digest: "d2"}),
+	}
+
+	typeOnly, rest := SplitTypeOnlyChanges(pairs)
+	if len(typeOnly) != 1 || typeOnly[0][0].Path != "a" {
+		t.Errorf("expected only 'a' to be a type only change, got %v", typeOnly)
+	}
+	if len(rest) != 4 {
+		t.Errorf("expected 4 remaining pairs, got %v", rest)
+	}
+}
+
+func Test_WithCaseMismatchesDeleted(t *testing.T) {
+	src, dst := makeDepotFilesFromString("a,B,c,D"), makeDepotFilesFromString("A,b,c,D,e")
+	diff := Reconcile(src, dst, DstIsCaseInsensitive)
+	checkReconcileWithExpected(t, diff, Expected{"c:c,D:D", "", "e", "a:A,B:b"})
+
+	actual := diff.WithCaseMismatchesDeleted()
+	checkReconcileWithExpected(t, actual, Expected{"c:c,D:D", "a,B", "e", ""})
+}
+
+func Test_FilesToCopy(t *testing.T) {
+	diff := DepotFileDiff{
+		Match: [][2]p4.DepotFile{
+			{{Path: "a", Type: "binary+l", Digest: "d1"}, {Path: "a", Type: "binary", Digest: "d1"}},
+			{{Path: "b", Type: "text", Digest: "d1"}, {Path: "b", Type: "text", Digest: "d2"}},
+		},
+		SrcOnly:      []p4.DepotFile{{Path: "c"}},
+		DstOnly:      []p4.DepotFile{{Path: "d"}},
+		CaseMismatch: [][2]p4.DepotFile{{{Path: "e"}, {Path: "E"}}},
+	}
+
+	cases := []struct {
+		Name            string
+		RetypeInPlace   bool
+		SubmitCaseFixes bool
+		Expected        string
+	}{
+		{"default", false, false, "a,b,c"},
+		{"retype in place", true, false, "b,c"},
+		{"submit case fixes", false, true, "a,b,c,e"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var cfg config.Config
+			cfg.Dst.RetypeInPlace = config.Bool(tc.RetypeInPlace)
+			cfg.Dst.SubmitCaseFixes = config.Bool(tc.SubmitCaseFixes)
+
+			var paths []string
+			for _, f := range FilesToCopy(cfg, diff) {
+				paths = append(paths, f.Path)
+			}
+			if actual := strings.Join(paths, ","); actual != tc.Expected {
+				t.Errorf("expected %s, got %s", tc.Expected, actual)
+			}
+		})
+	}
+}
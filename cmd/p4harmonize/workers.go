@@ -0,0 +1,44 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// RunWorkers calls fn once for each index from 0 to n-1, with at most workers calls running at the same
+// time (or runtime.NumCPU(), if workers is less than 1). Every call is made, even after some have failed.
+// Returns the errors from any calls that failed, in index order.
+func RunWorkers(n, workers int, fn func(i int) error) []error {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func Test_RunWorkers(t *testing.T) {
+	const n = 100
+	var calls, running, maxRunning int32
+	errs := RunWorkers(n, 4, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		cur := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if cur <= max || atomic.CompareAndSwapInt32(&maxRunning, max, cur) {
+				break
+			}
+		}
+		if i%10 == 3 {
+			return fmt.Errorf("file %d failed", i)
+		}
+		return nil
+	})
+
+	if calls != n {
+		t.Errorf("expected %d calls, got %d", n, calls)
+	}
+	if maxRunning > 4 {
+		t.Errorf("expected at most 4 calls at once, got %d", maxRunning)
+	}
+	if len(errs) != 10 {
+		t.Fatalf("expected 10 errors, got %d: %v", len(errs), errs)
+	}
+	for i, err := range errs {
+		if expected := fmt.Sprintf("file %d failed", i*10+3); err.Error() != expected {
+			t.Errorf("expected error %d to be '%s', got '%v'", i, expected, err)
+		}
+	}
+}
+
+func Test_RunWorkersNone(t *testing.T) {
+	errs := RunWorkers(0, 0, func(i int) error {
+		return fmt.Errorf("unexpected call %d", i)
+	})
+	if len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
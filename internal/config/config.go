@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"text/template"
 
 	"github.com/BurntSushi/toml"
 )
@@ -14,8 +15,41 @@ type Source struct {
 	P4User    string `toml:"p4user"`
 	P4Charset string `toml:"p4charset"`
 	P4Client  string `toml:"p4client"`
+	Revision  string `toml:"revision,omitempty"`  // ie "@12345", "@label", or "@2024/05/01" (default is "#head")
+	Fetch     string `toml:"fetch,omitempty"`     // how to get the content of source files (see FetchSync and FetchPrint)
+	FullSync  *bool  `toml:"full_sync,omitempty"` // sync the whole source client, instead of just the files that need copying
+
+	// WorkspaceCheck is what to do about source files that were changed or deleted in the source client's
+	// root without being checked out (see WorkspaceCheckAbort and WorkspaceCheckResync). Empty means don't check.
+	WorkspaceCheck string `toml:"workspace_check,omitempty"`
+}
+
+// Values for Source.Fetch
+const (
+	FetchSync  = "sync"  // sync the source client, then copy files from its root (the default)
+	FetchPrint = "print" // don't sync the source client, just print the files that are needed straight into the destination
+)
+
+// Values for Source.WorkspaceCheck
+const (
+	WorkspaceCheckAbort  = "abort"  // stop before copying anything, and list the changed files
+	WorkspaceCheckResync = "resync" // force sync the changed files, so they match the depot again
+)
+
+// RevisionOrHead returns the revision specifier to harmonize the source at, which is "#head" if
+// no revision was set.
+func (s *Source) RevisionOrHead() string {
+	if len(s.Revision) == 0 {
+		return "#head"
+	}
+	return s.Revision
 }
 
+// DefaultDescription is the changelist description template used when none is set in the config.
+const DefaultDescription = `p4harmonize` +
+	`{{if .CaseFixChange}}, including re-adding the files deleted in change {{.CaseFixChange}} with the correct case{{end}}` +
+	`{{if gt .Parts 1}} (part {{.Part}} of {{.Parts}}){{end}}`
+
 type Destination struct {
 	P4Port       string `toml:"p4port"`
 	P4User       string `toml:"p4user"`
@@ -23,20 +57,284 @@ type Destination struct {
 	ClientName   string `toml:"new_client_name"`
 	ClientRoot   string `toml:"new_client_root"`
 	ClientStream string `toml:"new_client_stream"`
+
+	// Description is a Go text/template used to write the description of each changelist. See the README
+	// for the available fields. If empty, DefaultDescription is used.
+	Description string `toml:"description,omitempty"`
+
+	// RetypeInPlace changes the type of files whose content already matches using "p4 retype", instead of
+	// copying the file and opening it for edit. This is much faster, but requires admin access, and the
+	// type changes happen immediately, instead of waiting in the changelist for review.
+	RetypeInPlace *bool `toml:"retype_in_place,omitempty"`
+
+	// SubmitCaseFixes fixes files with mismatched case on case insensitive servers in a single run, by
+	// submitting a changelist that deletes them, before building the changelist that re-adds them.
+	SubmitCaseFixes *bool `toml:"submit_case_fixes,omitempty"`
+
+	// Limits on the size of each changelist. When any is set, the changes are spread across as many
+	// changelists as needed to stay within all of them. Zero means no limit.
+	MaxFilesPerChangelist  int   `toml:"max_files_per_changelist,omitempty"`
+	MaxBytesPerChangelist  int64 `toml:"max_bytes_per_changelist,omitempty"`
+	ChangelistPerDirectory *bool `toml:"changelist_per_directory,omitempty"` // one changelist (or more) per top-level directory
+
+	// CopyStrategy is how files are copied from the source client's root into the new client's root
+	// (see CopyStrategyCopy, CopyStrategyReflink, and CopyStrategyHardlink). Empty means CopyStrategyCopy.
+	CopyStrategy string `toml:"copy_strategy,omitempty"`
+
+	// VerifyCopies checks the MD5 of each copied file against the digest reported by the source server,
+	// and stops before opening any files in the changelist if any don't match.
+	VerifyCopies *bool `toml:"verify_copies,omitempty"`
+}
+
+// Values for Destination.CopyStrategy
+const (
+	CopyStrategyCopy     = "copy"     // copy the bytes of each file (the default)
+	CopyStrategyReflink  = "reflink"  // clone each file (copy-on-write), or copy its bytes if the filesystem can't
+	CopyStrategyHardlink = "hardlink" // clone each file if possible, else hardlink it, else copy its bytes
+)
+
+// SplitsChangelists returns true if any of the limits on the size of each changelist are set.
+func (d *Destination) SplitsChangelists() bool {
+	return d.MaxFilesPerChangelist > 0 || d.MaxBytesPerChangelist > 0 || Enabled(d.ChangelistPerDirectory)
+}
+
+// Filter limits which files get harmonized. Patterns are matched against file paths relative to the
+// root of the stream (ie "Engine/Build/Build.version"), ignoring case, and may use perforce wildcards
+// ("..." matches anything, "*" matches anything except "/"). If there are any Include patterns, then
+// only files that match at least one of them are kept. Files that match any Exclude pattern are dropped.
+type Filter struct {
+	Include []string `toml:"include,omitempty"`
+	Exclude []string `toml:"exclude,omitempty"`
+}
+
+// TypeMap changes the type of matching source files before they are compared with the destination, and
+// before they are added or edited in the destination. A source file matches if its type is From, and its
+// path matches at least one of Paths (using the same rules as Filter), or if Paths is empty.
+type TypeMap struct {
+	From  string   `toml:"from"`
+	To    string   `toml:"to"`
+	Paths []string `toml:"paths,omitempty"`
+}
+
+// Mapping is a single source/destination pair. Any values left empty (or left out, for bool settings) in a
+// mapping's source or destination are filled in from the top-level source and destination (see Resolve).
+type Mapping struct {
+	Name     string      `toml:"name"`
+	Src      Source      `toml:"source"`
+	Dst      Destination `toml:"destination"`
+	Filter   Filter      `toml:"filter,omitempty"`
+	TypeMaps []TypeMap   `toml:"type_map,omitempty"`
 }
 
 type Config struct {
-	Src Source      `toml:"source"`
-	Dst Destination `toml:"destination"`
+	Src      Source      `toml:"source"`
+	Dst      Destination `toml:"destination"`
+	Filter   Filter      `toml:"filter,omitempty"`
+	TypeMaps []TypeMap   `toml:"type_map,omitempty"`
+	Mappings []Mapping   `toml:"mapping,omitempty"`
 
 	// save the file from which this config was loaded, for logging purposes
 	filename string
+	// name of the mapping this config was resolved from (empty if there were no mappings)
+	name string
 }
 
 func (c *Config) Filename() string {
 	return c.filename
 }
 
+// Name returns the name of the mapping this config was resolved from, or an empty string if this
+// config was not resolved from a mapping.
+func (c *Config) Name() string {
+	return c.name
+}
+
+// Resolve returns one config per mapping, where each config's source, destination, and filter are the
+// mapping's, with any empty values filled in from the top-level source, destination, and filter. Each
+// config's type maps are the mapping's, followed by the top-level ones. If there are no mappings, then
+// the only config returned is a copy of this one.
+func (c *Config) Resolve() []Config {
+	if len(c.Mappings) == 0 {
+		return []Config{*c}
+	}
+
+	out := make([]Config, 0, len(c.Mappings))
+	for _, m := range c.Mappings {
+		out = append(out, Config{
+			Src:      mergeSource(c.Src, m.Src),
+			Dst:      mergeDestination(c.Dst, m.Dst),
+			Filter:   mergeFilter(c.Filter, m.Filter),
+			TypeMaps: append(append([]TypeMap{}, m.TypeMaps...), c.TypeMaps...),
+			filename: c.filename,
+			name:     m.Name,
+		})
+	}
+	return out
+}
+
+func mergeSource(base, over Source) Source {
+	return Source{
+		P4Port:    firstNonEmpty(over.P4Port, base.P4Port),
+		P4User:    firstNonEmpty(over.P4User, base.P4User),
+		P4Charset: firstNonEmpty(over.P4Charset, base.P4Charset),
+		P4Client:  firstNonEmpty(over.P4Client, base.P4Client),
+		Revision:  firstNonEmpty(over.Revision, base.Revision),
+		Fetch:     firstNonEmpty(over.Fetch, base.Fetch),
+		FullSync:  firstSet(over.FullSync, base.FullSync),
+
+		WorkspaceCheck: firstNonEmpty(over.WorkspaceCheck, base.WorkspaceCheck),
+	}
+}
+
+func mergeDestination(base, over Destination) Destination {
+	return Destination{
+		P4Port:       firstNonEmpty(over.P4Port, base.P4Port),
+		P4User:       firstNonEmpty(over.P4User, base.P4User),
+		P4Charset:    firstNonEmpty(over.P4Charset, base.P4Charset),
+		ClientName:   firstNonEmpty(over.ClientName, base.ClientName),
+		ClientRoot:   firstNonEmpty(over.ClientRoot, base.ClientRoot),
+		ClientStream: firstNonEmpty(over.ClientStream, base.ClientStream),
+		Description:  firstNonEmpty(over.Description, base.Description),
+
+		RetypeInPlace:   firstSet(over.RetypeInPlace, base.RetypeInPlace),
+		SubmitCaseFixes: firstSet(over.SubmitCaseFixes, base.SubmitCaseFixes),
+
+		MaxFilesPerChangelist:  firstNonZero(over.MaxFilesPerChangelist, base.MaxFilesPerChangelist),
+		MaxBytesPerChangelist:  firstNonZero(over.MaxBytesPerChangelist, base.MaxBytesPerChangelist),
+		ChangelistPerDirectory: firstSet(over.ChangelistPerDirectory, base.ChangelistPerDirectory),
+
+		CopyStrategy: firstNonEmpty(over.CopyStrategy, base.CopyStrategy),
+		VerifyCopies: firstSet(over.VerifyCopies, base.VerifyCopies),
+	}
+}
+
+func mergeFilter(base, over Filter) Filter {
+	out := over
+	if len(out.Include) == 0 {
+		out.Include = base.Include
+	}
+	if len(out.Exclude) == 0 {
+		out.Exclude = base.Exclude
+	}
+	return out
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// firstSet returns the first of the passed optional bools that was set (so a mapping can turn off a
+// setting that is turned on at the top level), or nil if none were set.
+func firstSet(values ...*bool) *bool {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func firstNonZero[T int | int64](values ...T) T {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// Enabled returns the value of an optional bool setting, which is false if the setting was left out.
+func Enabled(setting *bool) bool {
+	return setting != nil && *setting
+}
+
+// Bool returns a pointer to the passed value, for filling in optional bool settings.
+func Bool(value bool) *bool {
+	return &value
+}
+
+// SameServer returns true if the source and destination are on the same Perforce server, in which case
+// files can be copied on the server, instead of through the source and destination clients.
+func (c *Config) SameServer() bool {
+	return c.Src.P4Port == c.Dst.P4Port
+}
+
+// SyncsSource returns true if the source client needs to be synced before files can be copied from it.
+func (c *Config) SyncsSource() bool {
+	return !c.SameServer() && c.Src.Fetch != FetchPrint
+}
+
+// Validate returns an error if any values in the config are malformed, or if any mappings are
+// missing a name, or share a name, destination client, or destination client root with another mapping.
+func (c *Config) Validate() error {
+	names := make(map[string]bool, len(c.Mappings))
+	clients := make(map[string]bool, len(c.Mappings))
+	roots := make(map[string]bool, len(c.Mappings))
+	for _, r := range c.Resolve() {
+		if len(c.Mappings) > 0 {
+			switch {
+			case len(r.name) == 0:
+				return fmt.Errorf("every mapping must have a name")
+			case names[r.name]:
+				return fmt.Errorf("more than one mapping is named '%s'", r.name)
+			case clients[r.Dst.ClientName]:
+				return fmt.Errorf("mapping '%s' uses the same new_client_name as another mapping", r.name)
+			case roots[r.Dst.ClientRoot]:
+				return fmt.Errorf("mapping '%s' uses the same new_client_root as another mapping", r.name)
+			}
+			names[r.name] = true
+			clients[r.Dst.ClientName] = true
+			roots[r.Dst.ClientRoot] = true
+		}
+
+		for _, tm := range r.TypeMaps {
+			if len(tm.From) == 0 || len(tm.To) == 0 {
+				return fmt.Errorf("every type_map must have both a 'from' and a 'to' type")
+			}
+		}
+
+		switch r.Src.Fetch {
+		case "", FetchSync, FetchPrint:
+		default:
+			return fmt.Errorf("source fetch '%s' must be '%s' or '%s'", r.Src.Fetch, FetchSync, FetchPrint)
+		}
+
+		switch r.Src.WorkspaceCheck {
+		case "", WorkspaceCheckAbort, WorkspaceCheckResync:
+		default:
+			return fmt.Errorf("source workspace_check '%s' must be '%s' or '%s'",
+				r.Src.WorkspaceCheck, WorkspaceCheckAbort, WorkspaceCheckResync)
+		}
+
+		switch r.Dst.CopyStrategy {
+		case "", CopyStrategyCopy, CopyStrategyReflink, CopyStrategyHardlink:
+		default:
+			return fmt.Errorf("destination copy_strategy '%s' must be '%s', '%s', or '%s'",
+				r.Dst.CopyStrategy, CopyStrategyCopy, CopyStrategyReflink, CopyStrategyHardlink)
+		}
+
+		if _, err := template.New("description").Parse(r.Dst.Description); err != nil {
+			return fmt.Errorf("invalid description template: %w", err)
+		}
+
+		if r.Dst.MaxFilesPerChangelist < 0 || r.Dst.MaxBytesPerChangelist < 0 {
+			return fmt.Errorf("max_files_per_changelist and max_bytes_per_changelist cannot be negative")
+		}
+
+		if len(r.Src.Revision) > 0 {
+			if len(r.Src.Revision) < 2 || (r.Src.Revision[0] != '@' && r.Src.Revision[0] != '#') {
+				return fmt.Errorf("source revision '%s' must start with '@' or '#', ie '@12345', '@label', or '@2024/05/01'", r.Src.Revision)
+			}
+		}
+	}
+	return nil
+}
+
 func (c *Config) WriteToFile(path string) error {
 	f, err := os.Create(path)
 	if err != nil {
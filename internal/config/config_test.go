@@ -0,0 +1,284 @@
+package config
+
+import (
+	"testing"
+)
+
+func Test_ValidateRevision(t *testing.T) {
+	var cases = []struct {
+		Revision string
+		IsValid  bool
+	}{
+		{"", true},
+		{"#head", true},
+		{"@12345", true},
+		{"@release-5.4.1", true},
+		{"@2024/05/01", true},
+		{"12345", false},
+		{"@", false},
+		{"head", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Revision, func(t *testing.T) {
+			cfg, err := LoadFromString("[source]\nrevision = \"" + tc.Revision + "\"\n")
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			err = cfg.Validate()
+			if tc.IsValid && err != nil {
+				t.Errorf("expected '%s' to be valid, got: %v", tc.Revision, err)
+			}
+			if !tc.IsValid && err == nil {
+				t.Errorf("expected '%s' to be invalid", tc.Revision)
+			}
+		})
+	}
+}
+
+func Test_SyncsSource(t *testing.T) {
+	var cases = []struct {
+		Name     string
+		Config   string
+		Expected bool
+	}{
+		{"default", "[source]\np4port = \"a:1666\"\n[destination]\np4port = \"b:1666\"\n", true},
+		{"fetch sync", "[source]\np4port = \"a:1666\"\nfetch = \"sync\"\n[destination]\np4port = \"b:1666\"\n", true},
+		{"fetch print", "[source]\np4port = \"a:1666\"\nfetch = \"print\"\n[destination]\np4port = \"b:1666\"\n", false},
+		{"same server", "[source]\np4port = \"a:1666\"\n[destination]\np4port = \"a:1666\"\n", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cfg, err := LoadFromString(tc.Config)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("expected config to be valid, got: %v", err)
+			}
+			if actual := cfg.SyncsSource(); actual != tc.Expected {
+				t.Errorf("expected SyncsSource() to be %v, got %v", tc.Expected, actual)
+			}
+		})
+	}
+
+	cfg, err := LoadFromString("[source]\nfetch = \"download\"\n")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected an unknown fetch to be invalid")
+	}
+}
+
+func Test_ValidateWorkspaceCheck(t *testing.T) {
+	for _, check := range []string{"abort", "resync"} {
+		cfg, err := LoadFromString("[source]\nworkspace_check = \"" + check + "\"\n")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected workspace_check '%s' to be valid, got: %v", check, err)
+		}
+	}
+
+	cfg, err := LoadFromString("[source]\nworkspace_check = \"ignore\"\n")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected an unknown workspace_check to be invalid")
+	}
+}
+
+func Test_ValidateCopyStrategy(t *testing.T) {
+	for _, strategy := range []string{"copy", "reflink", "hardlink"} {
+		cfg, err := LoadFromString("[destination]\ncopy_strategy = \"" + strategy + "\"\n")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("expected copy_strategy '%s' to be valid, got: %v", strategy, err)
+		}
+	}
+
+	cfg, err := LoadFromString("[destination]\ncopy_strategy = \"symlink\"\n")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected an unknown copy_strategy to be invalid")
+	}
+}
+
+func Test_ResolveMappings(t *testing.T) {
+	cfg, err := LoadFromString(`
+[source]
+p4port = "ssl:epic:1666"
+p4user = "user"
+
+[destination]
+p4port = "local:1666"
+p4user = "localuser"
+new_client_root = "d:/p4/harmonize"
+
+[[mapping]]
+name = "engine"
+[mapping.source]
+p4client = "user-engine"
+[mapping.destination]
+new_client_name = "harmonize-engine"
+new_client_root = "d:/p4/harmonize-engine"
+new_client_stream = "//proj/engine_epic"
+
+[[mapping]]
+name = "plugin"
+[mapping.source]
+p4user = "pluginuser"
+p4client = "user-plugin"
+revision = "@plugin-1.2"
+[mapping.destination]
+new_client_name = "harmonize-plugin"
+new_client_stream = "//proj/plugin_epic"
+`)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cfgs := cfg.Resolve()
+	if len(cfgs) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(cfgs))
+	}
+
+	engine, plugin := cfgs[0], cfgs[1]
+	if engine.Name() != "engine" || plugin.Name() != "plugin" {
+		t.Errorf("expected names engine and plugin, got %s and %s", engine.Name(), plugin.Name())
+	}
+	if engine.Src.P4Port != "ssl:epic:1666" || engine.Src.P4User != "user" || engine.Src.P4Client != "user-engine" {
+		t.Errorf("unexpected engine source: %#v", engine.Src)
+	}
+	if engine.Dst.ClientRoot != "d:/p4/harmonize-engine" || engine.Dst.P4User != "localuser" {
+		t.Errorf("unexpected engine destination: %#v", engine.Dst)
+	}
+	if plugin.Src.P4User != "pluginuser" || plugin.Src.Revision != "@plugin-1.2" {
+		t.Errorf("unexpected plugin source: %#v", plugin.Src)
+	}
+	if plugin.Dst.ClientRoot != "d:/p4/harmonize" || plugin.Dst.ClientStream != "//proj/plugin_epic" {
+		t.Errorf("unexpected plugin destination: %#v", plugin.Dst)
+	}
+}
+
+func Test_ValidateMappings(t *testing.T) {
+	var cases = []struct {
+		Name     string
+		Mappings string
+	}{
+		{"missing name", `
+[[mapping]]
+[mapping.destination]
+new_client_name = "a"
+new_client_root = "a"
+`},
+		{"duplicate name", `
+[[mapping]]
+name = "a"
+[mapping.destination]
+new_client_name = "a"
+new_client_root = "a"
+[[mapping]]
+name = "a"
+[mapping.destination]
+new_client_name = "b"
+new_client_root = "b"
+`},
+		{"duplicate client", `
+[[mapping]]
+name = "a"
+[mapping.destination]
+new_client_name = "a"
+new_client_root = "a"
+[[mapping]]
+name = "b"
+[mapping.destination]
+new_client_name = "a"
+new_client_root = "b"
+`},
+		{"duplicate root from top-level", `
+[destination]
+new_client_root = "shared"
+[[mapping]]
+name = "a"
+[mapping.destination]
+new_client_name = "a"
+[[mapping]]
+name = "b"
+[mapping.destination]
+new_client_name = "b"
+`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cfg, err := LoadFromString(tc.Mappings)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := cfg.Validate(); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func Test_ResolveMappingBools(t *testing.T) {
+	cfg, err := LoadFromString(`
+[source]
+full_sync = true
+
+[destination]
+verify_copies = true
+retype_in_place = true
+
+[[mapping]]
+name = "inherits"
+[mapping.destination]
+new_client_name = "a"
+new_client_root = "a"
+
+[[mapping]]
+name = "overrides"
+[mapping.source]
+full_sync = false
+[mapping.destination]
+new_client_name = "b"
+new_client_root = "b"
+verify_copies = false
+submit_case_fixes = true
+`)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cfgs := cfg.Resolve()
+	if len(cfgs) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(cfgs))
+	}
+
+	inherits, overrides := cfgs[0], cfgs[1]
+	if !Enabled(inherits.Src.FullSync) || !Enabled(inherits.Dst.VerifyCopies) || Enabled(inherits.Dst.SubmitCaseFixes) {
+		t.Errorf("expected mapping 'inherits' to keep the top-level settings, got: %#v, %#v", inherits.Src, inherits.Dst)
+	}
+	if Enabled(overrides.Src.FullSync) || Enabled(overrides.Dst.VerifyCopies) {
+		t.Errorf("expected mapping 'overrides' to turn off full_sync and verify_copies")
+	}
+	if !Enabled(overrides.Dst.RetypeInPlace) || !Enabled(overrides.Dst.SubmitCaseFixes) {
+		t.Errorf("expected mapping 'overrides' to have retype_in_place and submit_case_fixes turned on")
+	}
+}
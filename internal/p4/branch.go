@@ -0,0 +1,37 @@
+package p4
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CreateBranch creates (or replaces) the named branch spec, with a view that maps the first depot path of
+// each pair in view (the source) to the second (the target).
+func (p *P4) CreateBranch(name string, view [][2]string) error {
+	// generate a branch spec
+	var sb strings.Builder
+	sb.Grow(512)
+	if err := p.sh.Cmdf(`%s branch -o %s`, p.cmd(), name).Out(&sb).RunErr(); err != nil {
+		return fmt.Errorf("error building branch spec: %w", err)
+	}
+
+	lines := make([]string, len(view))
+	for i, v := range view {
+		lines[i] = fmt.Sprintf(`"%s" "%s"`, v[0], v[1])
+	}
+	spec := setSpecField(sb.String(), "View", strings.Join(lines, "\n"))
+
+	// feed the spec back into p4 to create the branch
+	if err := p.sh.Cmdf(`%s branch -i`, p.cmd()).In(strings.NewReader(spec)).RunErr(); err != nil {
+		return fmt.Errorf("error creating branch from spec: %w", err)
+	}
+	return nil
+}
+
+// DeleteBranch deletes the named branch spec.
+func (p *P4) DeleteBranch(name string) error {
+	if err := p.sh.Cmdf(`%s branch -d %s`, p.cmd(), name).RunErr(); err != nil {
+		return fmt.Errorf("error deleting branch '%s': %w", name, err)
+	}
+	return nil
+}
@@ -6,26 +6,23 @@ import (
 	"strings"
 )
 
-// CreateEmptyChangelist creates a new changelist
+// CreateEmptyChangelist creates a new changelist with the given description, which may be more than one line.
 func (p *P4) CreateEmptyChangelist(description string) (int64, error) {
-	if strings.Contains(description, `"`) {
-		// TODO: this is because of how we're building the change spec below.
-		// This could be fixed in the future to remove this limitation, if there's ever a need.
-		return 0, fmt.Errorf("double quotes not currently supported in changelist description")
-	}
-
 	// generate a changelist spec
 	var clspec strings.Builder
 	clspec.Grow(256)
-	cmd := fmt.Sprintf(`%s --field "Description=%s" --field "Files=" change -o`, p.cmd(), description)
-	if err := p.sh.Cmd(cmd).Out(&clspec).RunErr(); err != nil {
+	if err := p.sh.Cmdf(`%s change -o`, p.cmd()).Out(&clspec).RunErr(); err != nil {
 		return 0, fmt.Errorf("error building changelist spec: %w", err)
 	}
 
+	// fill in the description, and leave out any files that are open in the default changelist
+	spec := setSpecField(clspec.String(), "Description", description)
+	spec = setSpecField(spec, "Files", "")
+
 	// feed the spec back into p4 to create the changelist
 	var clnum strings.Builder
 	clnum.Grow(64)
-	specReader := strings.NewReader(clspec.String())
+	specReader := strings.NewReader(spec)
 	if err := p.sh.Cmdf(`%s change -i`, p.cmd()).In(specReader).Out(&clnum).RunErr(); err != nil {
 		return 0, fmt.Errorf("error creating changelist: %w", err)
 	}
@@ -37,3 +34,115 @@ func (p *P4) CreateEmptyChangelist(description string) (int64, error) {
 	}
 	return cl, nil
 }
+
+// LatestChange returns the number of the most recent submitted changelist that affects the given
+// path (which may include a revision specifier), or 0 if no submitted changelist affects that path.
+func (p *P4) LatestChange(path string) (int64, error) {
+	var sb strings.Builder
+	sb.Grow(64)
+	err := p.sh.Cmdf(`%s -F %%change%% changes -m1 -s submitted "%s"`, p.cmd(), path).Out(&sb).RunErr()
+	if err != nil {
+		return 0, fmt.Errorf("error getting latest change for %s: %w", path, err)
+	}
+
+	raw := strings.TrimSpace(sb.String())
+	if len(raw) == 0 {
+		return 0, nil
+	}
+	cl, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse changelist number from '%s': %v", raw, err)
+	}
+	return cl, nil
+}
+
+// PendingChangelists returns the numbers of the pending changelists of the current client, newest first.
+// This includes changelists that have shelved files.
+func (p *P4) PendingChangelists() ([]int64, error) {
+	return p.listChangelists("pending")
+}
+
+// ShelvedChangelists returns the numbers of the changelists of the current client that have shelved files,
+// newest first.
+func (p *P4) ShelvedChangelists() ([]int64, error) {
+	return p.listChangelists("shelved")
+}
+
+func (p *P4) listChangelists(status string) ([]int64, error) {
+	var out []int64
+	err := p.cmdAndScan(
+		fmt.Sprintf(`%s -F %%change%% changes -s %s -c %s`, p.cmd(), status, p.Client),
+		func(line string) error {
+			raw := strings.TrimSpace(line)
+			if len(raw) == 0 {
+				return nil
+			}
+			cl, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("unable to parse changelist number from '%s': %v", raw, err)
+			}
+			out = append(out, cl)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s changelists for %s: %w", status, p.Client, err)
+	}
+	return out, nil
+}
+
+// DeleteChangelist deletes a pending changelist that has no open or shelved files.
+func (p *P4) DeleteChangelist(cl int64) error {
+	return p.sh.Cmdf(`%s change -d %d`, p.cmd(), cl).RunErr()
+}
+
+// setSpecField replaces the value of the named field in a form-style spec (the output of commands like
+// "p4 change -o"), adding the field to the end if it is missing. Each line of value becomes a line of the
+// field. An empty value removes the field entirely.
+func setSpecField(spec, field, value string) string {
+	var sb strings.Builder
+	sb.Grow(len(spec) + len(value))
+
+	writeField := func() {
+		if len(value) == 0 {
+			return
+		}
+		sb.WriteString(field)
+		sb.WriteString(":\n")
+		for _, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+			sb.WriteString("\t")
+			sb.WriteString(strings.TrimRight(line, "\r"))
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	var found, skipping bool
+	for _, line := range strings.Split(spec, "\n") {
+		if skipping {
+			// the field's value continues until the next line that isn't indented or blank
+			if len(strings.TrimSpace(line)) == 0 || line[0] == '\t' || line[0] == ' ' {
+				continue
+			}
+			skipping = false
+		}
+		if !found && strings.HasPrefix(line, field+":") {
+			found = true
+			skipping = true
+			writeField()
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+
+	out := strings.TrimRight(sb.String(), "\n") + "\n"
+	if !found && len(value) > 0 {
+		sb.Reset()
+		sb.WriteString(out)
+		sb.WriteString("\n")
+		writeField()
+		out = sb.String()
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package p4
+
+import (
+	"testing"
+)
+
+func Test_SetSpecField(t *testing.T) {
+	const spec = "# A Perforce Change Specification.\n" +
+		"#  Description: Comments about the changelist.  Required.\n" +
+		"\n" +
+		"Change:\tnew\n" +
+		"\n" +
+		"Client:\tfoo\n" +
+		"\n" +
+		"Description:\n" +
+		"\t<enter description here>\n" +
+		"\n" +
+		"Files:\n" +
+		"\t//foo/bar.txt\t# edit\n" +
+		"\t//foo/baz.txt\t# add\n"
+
+	var cases = []struct {
+		Name     string
+		Field    string
+		Value    string
+		Expected string
+	}{
+		{"replace one line", "Description", "p4harmonize",
+			"# A Perforce Change Specification.\n" +
+				"#  Description: Comments about the changelist.  Required.\n" +
+				"\n" +
+				"Change:\tnew\n" +
+				"\n" +
+				"Client:\tfoo\n" +
+				"\n" +
+				"Description:\n" +
+				"\tp4harmonize\n" +
+				"\n" +
+				"Files:\n" +
+				"\t//foo/bar.txt\t# edit\n" +
+				"\t//foo/baz.txt\t# add\n",
+		},
+		{"multiple lines and quotes", "Description", "p4harmonize \"5.3.2\"\n\nfrom ssl:src:1666\n",
+			"# A Perforce Change Specification.\n" +
+				"#  Description: Comments about the changelist.  Required.\n" +
+				"\n" +
+				"Change:\tnew\n" +
+				"\n" +
+				"Client:\tfoo\n" +
+				"\n" +
+				"Description:\n" +
+				"\tp4harmonize \"5.3.2\"\n" +
+				"\t\n" +
+				"\tfrom ssl:src:1666\n" +
+				"\n" +
+				"Files:\n" +
+				"\t//foo/bar.txt\t# edit\n" +
+				"\t//foo/baz.txt\t# add\n",
+		},
+		{"remove last field", "Files", "",
+			"# A Perforce Change Specification.\n" +
+				"#  Description: Comments about the changelist.  Required.\n" +
+				"\n" +
+				"Change:\tnew\n" +
+				"\n" +
+				"Client:\tfoo\n" +
+				"\n" +
+				"Description:\n" +
+				"\t<enter description here>\n",
+		},
+		{"add missing field", "Jobs", "job000123",
+			spec + "\n" + "Jobs:\n\tjob000123\n\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := setSpecField(spec, tc.Field, tc.Value)
+			if actual != tc.Expected {
+				t.Fatalf("Expected:\n%q\nActual:\n%q", tc.Expected, actual)
+			}
+		})
+	}
+}
@@ -33,11 +33,22 @@ func (p *P4) CreateStreamClient(clientname string, root string, stream string) e
 	return nil
 }
 
-// DeleteClient deletes an existing client spec that has no changelists or open files
-func (p *P4) DeleteClient(clientname string) error {
-	err := p.sh.Cmdf("%s client -d %s", p.cmd(), clientname).RunErr()
+// DeleteClient deletes an existing client spec that has no changelists or open files.
+// With the KeepShelves option, a client that still has shelved files can be deleted, leaving the shelved
+// files in place.
+func (p *P4) DeleteClient(clientname string, opts ...Option) error {
+	var args []string
+	for _, o := range opts {
+		switch o.(type) {
+		case oKeepShelves:
+			args = append(args, "-f -Fs")
+		default:
+			return fmt.Errorf("unrecognized option %s", o.String())
+		}
+	}
+	err := p.sh.Cmdf("%s client -d %s %s", p.cmd(), strings.Join(args, " "), clientname).RunErr()
 	if err != nil {
-		return fmt.Errorf("error deleting client '%s': %w", p.Client, err)
+		return fmt.Errorf("error deleting client '%s': %w", clientname, err)
 	}
 	return nil
 }
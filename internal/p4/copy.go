@@ -0,0 +1,37 @@
+package p4
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CopyBranch opens the given target files of a branch spec so that they will exactly match their source
+// files once submitted, keeping the integration history. Everything happens on the server; no file content
+// is transferred to the client. Each target is a depot path on the target side of the branch spec's view,
+// and may end with a revision specifier, which selects the revision of its source file to copy.
+func (p *P4) CopyBranch(branch string, targets []string, opts ...Option) error {
+	var args []string
+	for _, o := range opts {
+		switch ot := o.(type) {
+		case oChangelist:
+			if ot.CL > 0 {
+				args = append(args, fmt.Sprintf("-c %d", ot.CL))
+			}
+		default:
+			return fmt.Errorf("unrecognized option %s", o.String())
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// write paths to disk to avoid command line character limit
+	fnCleanup, filename, err := WriteTempFile("p4harmonize_copy_*.txt", strings.Join(targets, "\n"))
+	if err != nil {
+		return err
+	}
+	defer fnCleanup()
+
+	return p.sh.Cmdf(`%s -x "%s" copy -v %s -b %s`, p.cmd(), filename, strings.Join(args, " "), branch).RunErr()
+}
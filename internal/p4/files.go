@@ -2,15 +2,45 @@ package p4
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ListDepotFiles runs "p4 fstat" and parses the results into a slice of DepotFile structs.
 // Order of resulting slice is alphabetical by Path, ignoring case.
 func (p *P4) ListDepotFiles() ([]DepotFile, error) {
+	return p.ListDepotFilesAt("")
+}
+
+// ListDepotFilesAt is like ListDepotFiles, except it lists the files as of the given revision specifier,
+// for example "@12345", "@some_label", or "@2024/05/01". An empty revision means the head revision.
+func (p *P4) ListDepotFilesAt(revision string) ([]DepotFile, error) {
+	return p.listFiles(fmt.Sprintf("//%s/...%s", p.Client, revision))
+}
+
+// ModTime returns the modification time that a depot file (which may include a revision specifier) had when
+// it was submitted, which is what "p4 sync" gives files that keep their modification time (+m).
+func (p *P4) ModTime(depotPath string) (time.Time, error) {
+	var sb strings.Builder
+	err := p.sh.Cmdf(`%s -F %%headModTime%% fstat -T headModTime "%s"`, p.cmd(), depotPath).Out(&sb).RunErr()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting modification time of %s: %w", depotPath, err)
+	}
+
+	raw := strings.TrimSpace(sb.String())
+	secs, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse modification time from '%s': %v", raw, err)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+func (p *P4) listFiles(path string) ([]DepotFile, error) {
 	return p.runAndParseDepotFiles(
-		fmt.Sprintf(`%s fstat -T depotFile,headAction,headChange,headType,digest -Ol `+
-			`-F '^(headAction=move/delete | headAction=purge | headAction=archive | headAction=delete)' //%s/...`,
-			p.cmd(), p.Client,
+		fmt.Sprintf(`%s fstat -T depotFile,headAction,headChange,headType,digest,fileSize -Ol `+
+			`-F '^(headAction=move/delete | headAction=purge | headAction=archive | headAction=delete)' "%s"`,
+			p.cmd(), path,
 		),
 	)
 }
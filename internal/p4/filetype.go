@@ -0,0 +1,194 @@
+package p4
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FileType is a perforce file type, split into its base type, modifiers, and the number of revisions
+// stored. Every spelling of the same type parses to the same FileType, so two types are equivalent if
+// their FileTypes are equal (see ParseFileType).
+type FileType struct {
+	Base      string   // ie "text", "binary", "unicode", "utf16", "symlink", "apple"
+	Modifiers Modifier // all the modifiers except +S
+	Storage   int      // number of revisions stored (+S1 to +S512), where 0 means all of them
+}
+
+// Modifier is a set of file type modifiers, as bit flags.
+type Modifier uint16
+
+const (
+	ModCompressed   Modifier = 1 << iota // +C, store full compressed revisions
+	ModDeltas                            // +D, store revisions as deltas
+	ModUncompressed                      // +F, store full uncompressed revisions
+	ModArchive                           // +X, archive trigger supplies the content
+	ModKeywords                          // +k, expand keywords
+	ModOldKeywords                       // +ko, expand only $Id$ and $Header$ keywords
+	ModExclusive                         // +l, exclusive open (locking)
+	ModModTime                           // +m, preserve the file's modification time
+	ModWritable                          // +w, always writable in the workspace
+	ModExecutable                        // +x, executable bit set in the workspace
+)
+
+// modifierCodes is every Modifier with its code, in the order they are written by FileType.String.
+var modifierCodes = []struct {
+	mod  Modifier
+	code string
+}{
+	{ModCompressed, "C"},
+	{ModDeltas, "D"},
+	{ModUncompressed, "F"},
+	{ModArchive, "X"},
+	{ModKeywords, "k"},
+	{ModOldKeywords, "ko"},
+	{ModExclusive, "l"},
+	{ModModTime, "m"},
+	{ModWritable, "w"},
+	{ModExecutable, "x"},
+}
+
+var baseTypes = map[string]bool{
+	"text": true, "binary": true, "symlink": true, "apple": true, "resource": true,
+	"unicode": true, "utf8": true, "utf16": true,
+}
+
+// defaultStorage is the storage modifier each base type has when none is given. Writing it out doesn't
+// change the type, so it is dropped when parsing, ie "binary+C" is the same type as "binary".
+var defaultStorage = map[string]Modifier{
+	"text": ModDeltas, "binary": ModCompressed, "symlink": ModDeltas, "apple": ModCompressed,
+	"resource": ModCompressed, "unicode": ModDeltas, "utf8": ModDeltas, "utf16": ModDeltas,
+}
+
+// legacyTypes maps the older names for file types to the base type and modifiers they stand for.
+var legacyTypes = map[string]FileType{
+	"ctempobj":  {Base: "binary", Modifiers: ModWritable, Storage: 1},
+	"ctext":     {Base: "text", Modifiers: ModCompressed},
+	"cxtext":    {Base: "text", Modifiers: ModCompressed | ModExecutable},
+	"ktext":     {Base: "text", Modifiers: ModKeywords},
+	"kxtext":    {Base: "text", Modifiers: ModKeywords | ModExecutable},
+	"ltext":     {Base: "text", Modifiers: ModUncompressed},
+	"tempobj":   {Base: "binary", Modifiers: ModUncompressed | ModWritable, Storage: 1},
+	"ubinary":   {Base: "binary", Modifiers: ModUncompressed},
+	"uresource": {Base: "resource", Modifiers: ModUncompressed},
+	"uxbinary":  {Base: "binary", Modifiers: ModUncompressed | ModExecutable},
+	"xbinary":   {Base: "binary", Modifiers: ModExecutable},
+	"xltext":    {Base: "text", Modifiers: ModUncompressed | ModExecutable},
+	"xtempobj":  {Base: "binary", Modifiers: ModWritable | ModExecutable, Storage: 1},
+	"xtext":     {Base: "text", Modifiers: ModExecutable},
+	"xunicode":  {Base: "unicode", Modifiers: ModExecutable},
+	"xutf16":    {Base: "utf16", Modifiers: ModExecutable},
+	"xutf8":     {Base: "utf8", Modifiers: ModExecutable},
+}
+
+// ParseFileType parses a perforce file type, ie "text", "binary+Sl", "ktext", or "xbinary+S10".
+// Modifiers may be in any order, and may be repeated. A storage modifier that is the base type's default
+// is dropped (see defaultStorage).
+func ParseFileType(s string) (FileType, error) {
+	base, mods, hasMods := strings.Cut(s, "+")
+
+	ft, ok := legacyTypes[base]
+	if !ok {
+		if !baseTypes[base] {
+			return FileType{}, fmt.Errorf("unrecognized base file type '%s' in '%s'", base, s)
+		}
+		ft = FileType{Base: base}
+	}
+	if hasMods && len(mods) == 0 {
+		return FileType{}, fmt.Errorf("missing modifiers after '+' in '%s'", s)
+	}
+
+	for i := 0; i < len(mods); i++ {
+		switch c := mods[i]; c {
+		case 'S':
+			// +S is followed by an optional number of revisions
+			j := i + 1
+			for j < len(mods) && mods[j] >= '0' && mods[j] <= '9' {
+				j++
+			}
+			ft.Storage = 1
+			if j > i+1 {
+				n, err := strconv.Atoi(mods[i+1 : j])
+				if err != nil || n < 1 {
+					return FileType{}, fmt.Errorf("invalid storage modifier '%s' in '%s'", mods[i:j], s)
+				}
+				ft.Storage = n
+			}
+			i = j - 1
+		case 'k':
+			if i+1 < len(mods) && mods[i+1] == 'o' {
+				ft.Modifiers |= ModOldKeywords
+				i++
+			} else {
+				ft.Modifiers |= ModKeywords
+			}
+		default:
+			mod, ok := modifierFor(string(c))
+			if !ok {
+				return FileType{}, fmt.Errorf("unrecognized modifier '%c' in '%s'", c, s)
+			}
+			ft.Modifiers |= mod
+		}
+	}
+
+	ft.Modifiers &^= defaultStorage[ft.Base]
+	return ft, nil
+}
+
+func modifierFor(code string) (Modifier, bool) {
+	for _, mc := range modifierCodes {
+		if mc.code == code {
+			return mc.mod, true
+		}
+	}
+	return 0, false
+}
+
+// Has returns true if the file type has all of the passed modifiers.
+func (t FileType) Has(mod Modifier) bool {
+	return t.Modifiers&mod == mod
+}
+
+// String returns the file type in its canonical form: the base type, followed by any modifiers in a
+// fixed order, ie "binary+Sl" or "text+kx".
+func (t FileType) String() string {
+	var sb strings.Builder
+	sb.WriteString(t.Base)
+	if t.Modifiers == 0 && t.Storage == 0 {
+		return sb.String()
+	}
+
+	sb.WriteByte('+')
+	for _, mc := range modifierCodes {
+		if t.Has(mc.mod) {
+			sb.WriteString(mc.code)
+		}
+		// storage is written right after the other upper case modifiers
+		if mc.mod == ModArchive && t.Storage > 0 {
+			sb.WriteByte('S')
+			if t.Storage > 1 {
+				sb.WriteString(strconv.Itoa(t.Storage))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// CanonicalFileType returns the canonical spelling of a file type (see FileType.String), or the
+// passed type unchanged if it can't be parsed.
+func CanonicalFileType(s string) string {
+	ft, err := ParseFileType(s)
+	if err != nil {
+		return s
+	}
+	return ft.String()
+}
+
+// SameFileType returns true if a and b are spellings of the same file type, ie "ktext" and "text+k".
+// Types that can't be parsed are only the same if they are spelled exactly the same.
+func SameFileType(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return CanonicalFileType(a) == CanonicalFileType(b)
+}
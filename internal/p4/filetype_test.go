@@ -0,0 +1,106 @@
+package p4
+
+import "testing"
+
+func Test_ParseFileType(t *testing.T) {
+	var cases = []struct {
+		Type     string
+		Expected FileType
+	}{
+		{"text", FileType{Base: "text"}},
+		{"binary+l", FileType{Base: "binary", Modifiers: ModExclusive}},
+		{"binary+Sl", FileType{Base: "binary", Modifiers: ModExclusive, Storage: 1}},
+		{"binary+lS", FileType{Base: "binary", Modifiers: ModExclusive, Storage: 1}},
+		{"binary+S10w", FileType{Base: "binary", Modifiers: ModWritable, Storage: 10}},
+		{"text+ko", FileType{Base: "text", Modifiers: ModOldKeywords}},
+		{"text+kox", FileType{Base: "text", Modifiers: ModOldKeywords | ModExecutable}},
+		{"ktext", FileType{Base: "text", Modifiers: ModKeywords}},
+		{"kxtext+l", FileType{Base: "text", Modifiers: ModKeywords | ModExecutable | ModExclusive}},
+		{"tempobj", FileType{Base: "binary", Modifiers: ModUncompressed | ModWritable, Storage: 1}},
+		{"xunicode", FileType{Base: "unicode", Modifiers: ModExecutable}},
+		{"utf16+CFDXmw", FileType{Base: "utf16", Modifiers: ModCompressed | ModUncompressed | ModArchive | ModModTime | ModWritable}},
+		{"binary+C", FileType{Base: "binary"}},
+		{"text+Dl", FileType{Base: "text", Modifiers: ModExclusive}},
+		{"text+C", FileType{Base: "text", Modifiers: ModCompressed}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Type, func(t *testing.T) {
+			actual, err := ParseFileType(tc.Type)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if actual != tc.Expected {
+				t.Errorf("Expected %#v, got %#v", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func Test_ParseFileTypeErrors(t *testing.T) {
+	for _, s := range []string{"", "txt", "text+", "text+q", "binary+S0", "+l"} {
+		if _, err := ParseFileType(s); err == nil {
+			t.Errorf("expected '%s' to fail to parse", s)
+		}
+	}
+}
+
+func Test_CanonicalFileType(t *testing.T) {
+	var cases = []struct {
+		Type     string
+		Expected string
+	}{
+		{"text", "text"},
+		{"ktext", "text+k"},
+		{"text+k", "text+k"},
+		{"xbinary", "binary+x"},
+		{"binary+lS", "binary+Sl"},
+		{"binary+S1l", "binary+Sl"},
+		{"binary+lS16", "binary+S16l"},
+		{"binary+ll", "binary+l"},
+		{"tempobj", "binary+FSw"},
+		{"kxtext", "text+kx"},
+		{"text+xk", "text+kx"},
+		{"binary+C", "binary"},
+		{"binary+Cl", "binary+l"},
+		{"text+D", "text"},
+		{"ctext", "text+C"},
+		{"binary+D", "binary+D"},
+		{"unknown+z", "unknown+z"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Type, func(t *testing.T) {
+			if actual := CanonicalFileType(tc.Type); actual != tc.Expected {
+				t.Errorf("Expected '%s', got '%s'", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func Test_SameFileType(t *testing.T) {
+	var cases = []struct {
+		A, B     string
+		Expected bool
+	}{
+		{"ktext", "text+k", true},
+		{"xbinary", "binary+x", true},
+		{"binary+lS", "binary+Sl", true},
+		{"text", "text+k", false},
+		{"binary+S", "binary+S2", false},
+		{"binary", "binary+C", true},
+		{"text", "text+D", true},
+		{"xbinary", "binary+Cx", true},
+		{"apple+C", "apple", true},
+		{"binary", "binary+F", false},
+		{"text", "text+C", false},
+		{"unknown", "unknown", true},
+		{"unknown", "Unknown", false},
+	}
+
+	for _, tc := range cases {
+		if actual := SameFileType(tc.A, tc.B); actual != tc.Expected {
+			t.Errorf("SameFileType('%s', '%s'): expected %v, got %v", tc.A, tc.B, tc.Expected, actual)
+		}
+	}
+}
@@ -1,9 +1,6 @@
 package p4
 
-import (
-	"fmt"
-	"strings"
-)
+import "strings"
 
 type CaseType uint8
 
@@ -15,32 +12,29 @@ const (
 
 type Info struct {
 	CaseHandling CaseType
+	Unicode      bool // true if the server is in unicode mode
 }
 
 // Info runs the info command against the server.
 func (p *P4) Info() (Info, error) {
-	var info Info
-
-	err := p.cmdAndScan(
-		fmt.Sprintf("%s info", p.cmd()),
-		func(rawLine string) error {
-			line := strings.TrimSpace(rawLine)
-			if strings.HasPrefix(line, "Case Handling:") {
-				value := strings.TrimSpace(strings.TrimPrefix(line, "Case Handling:"))
-				switch value {
-				case "insensitive":
-					info.CaseHandling = CaseInsensitive
-				case "sensitive":
-					info.CaseHandling = CaseSensitive
-				}
-			}
-			return nil
-		},
-	)
-
+	var sb strings.Builder
+	sb.Grow(1024)
+	err := p.sh.Cmdf("%s -ztag info", p.cmd()).Out(&sb).RunErr()
 	if err != nil {
 		return Info{}, err
 	}
+	return ParseInfo(ParseSpec(sb.String())), nil
+}
 
-	return info, nil
+// ParseInfo reads the fields of "p4 -ztag info" (as returned by ParseSpec) that p4harmonize cares about.
+func ParseInfo(fields map[string]string) Info {
+	var info Info
+	switch strings.TrimSpace(fields["caseHandling"]) {
+	case "insensitive":
+		info.CaseHandling = CaseInsensitive
+	case "sensitive":
+		info.CaseHandling = CaseSensitive
+	}
+	info.Unicode = strings.TrimSpace(fields["unicode"]) == "enabled"
+	return info
 }
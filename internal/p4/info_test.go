@@ -0,0 +1,33 @@
+package p4
+
+import "testing"
+
+func Test_ParseInfo(t *testing.T) {
+	var cases = []struct {
+		Name     string
+		Output   string
+		Expected Info
+	}{
+		{"case insensitive, not unicode",
+			"... userName super\n... serverAddress perforce:1666\n... caseHandling insensitive\n",
+			Info{CaseHandling: CaseInsensitive},
+		},
+		{"case sensitive, unicode",
+			"... userName super\n... caseHandling sensitive\n... unicode enabled\n... serverVersion P4D/LINUX26X86_64/2023.1/2468153 (2023/05/01)\n",
+			Info{CaseHandling: CaseSensitive, Unicode: true},
+		},
+		{"missing fields",
+			"... userName super\n",
+			Info{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual := ParseInfo(ParseSpec(tc.Output))
+			if actual != tc.Expected {
+				t.Errorf("Expected %#v, got %#v", tc.Expected, actual)
+			}
+		})
+	}
+}
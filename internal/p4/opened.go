@@ -0,0 +1,37 @@
+package p4
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Opened returns the depot paths of the files open in the current client. With the Changelist option,
+// only the files open in that changelist are returned.
+func (p *P4) Opened(opts ...Option) ([]string, error) {
+	var args []string
+	for _, o := range opts {
+		switch ot := o.(type) {
+		case oChangelist:
+			if ot.CL > 0 {
+				args = append(args, fmt.Sprintf("-c %d", ot.CL))
+			}
+		default:
+			return nil, fmt.Errorf("unrecognized option %s", o.String())
+		}
+	}
+
+	var out []string
+	err := p.cmdAndScan(
+		fmt.Sprintf(`%s -F %%depotFile%% opened %s`, p.cmd(), strings.Join(args, " ")),
+		func(line string) error {
+			if path := strings.TrimSpace(line); len(path) > 0 {
+				out = append(out, path)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error listing opened files for %s: %w", p.Client, err)
+	}
+	return out, nil
+}
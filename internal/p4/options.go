@@ -60,3 +60,21 @@ type oAllowWildcards struct{}
 
 func (oAllowWildcards) isOption()      {}
 func (oAllowWildcards) String() string { return "AllowWildcards" }
+
+// Keep any shelved files when deleting a client (requires -f, so may require admin access)
+
+var KeepShelves oKeepShelves
+
+type oKeepShelves struct{}
+
+func (oKeepShelves) isOption()      {}
+func (oKeepShelves) String() string { return "KeepShelves" }
+
+// Force means to replace local files even if perforce thinks they are already up to date
+
+var Force oForce
+
+type oForce struct{}
+
+func (oForce) isOption()      {}
+func (oForce) String() string { return "Force" }
@@ -142,11 +142,13 @@ func (p *P4) cmdAndScan(cmd string, fnEachLine func(line string) error) error {
 }
 
 type DepotFile struct {
-	Path   string // relative to depot, ie 'Engine/foo', not '//UE4/Release/Engine/foo'
-	Action string
-	CL     string
-	Type   string
-	Digest string
+	Path     string `json:"path"` // relative to depot, ie 'Engine/foo', not '//UE4/Release/Engine/foo'
+	Action   string `json:"action,omitempty"`
+	CL       string `json:"change,omitempty"`
+	Type     string `json:"type,omitempty"`
+	OrigType string `json:"orig_type,omitempty"` // type in the depot, if Type was changed (ie by a type map)
+	Digest   string `json:"digest,omitempty"`
+	Size     int64  `json:"size,omitempty"` // in bytes, if known
 }
 
 // DepotFileCaseInsensitive allows sorting slices of DepotFile by path, but ignoring case.
@@ -159,8 +161,8 @@ func (x DepotFileCaseInsensitive) Less(i, j int) bool {
 func (x DepotFileCaseInsensitive) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
 
 // runAndParseDepotFiles calls the given command, which is expected to return a list of records, each
-// with at least a depotFile, and optionally also a type, change, action, digest, headType, headChange,
-// and headAction.
+// with at least a depotFile, and optionally also a type, change, action, digest, fileSize, headType,
+// headChange, and headAction.
 // The results are then sorted by Path (case-insensitive) and returned.
 func (p *P4) runAndParseDepotFiles(cmd string) ([]DepotFile, error) {
 	if !strings.Contains(cmd, "-ztag") && !strings.Contains(cmd, "-z tag") && !strings.Contains(cmd, "fstat") {
@@ -218,6 +220,12 @@ func (p *P4) runAndParseDepotFiles(cmd string) ([]DepotFile, error) {
 				cur.Type = strings.TrimSpace(line[12:])
 			case strings.HasPrefix(line[4:], "digest"):
 				cur.Digest = strings.TrimSpace(line[10:])
+			case strings.HasPrefix(line[4:], "fileSize"):
+				size, err := strconv.ParseInt(strings.TrimSpace(line[12:]), 10, 64)
+				if err != nil {
+					return fmt.Errorf("error parsing fileSize in '%s': %w", line, err)
+				}
+				cur.Size = size
 			}
 
 			return nil
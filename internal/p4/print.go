@@ -0,0 +1,32 @@
+package p4
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Print returns the contents of a depot file (which may include a revision specifier). The depot path must
+// already be escaped (see EscapePath). If there is no such file, the returned contents are empty.
+func (p *P4) Print(depotPath string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.sh.Cmdf(`%s print -q "%s"`, p.cmd(), depotPath).Out(&buf).RunErr(); err != nil {
+		return nil, fmt.Errorf("error printing '%s': %w", depotPath, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PrintToFile writes the contents of a depot file (which may include a revision specifier) to a local file,
+// creating the local file's folder if needed, and replacing the local file if it exists. The depot path must
+// already be escaped (see EscapePath), but the local path must not be.
+func (p *P4) PrintToFile(depotPath, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating folder for '%s': %w", localPath, err)
+	}
+	// p4 leaves the files it writes read-only, so remove any left by an earlier attempt
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing '%s': %w", localPath, err)
+	}
+	return p.sh.Cmdf(`%s print -q -o "%s" "%s"`, p.cmd(), localPath, depotPath).RunErr()
+}
@@ -0,0 +1,42 @@
+package p4
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Retype changes the filetype of the head revision of one or more existing files, in place on the server.
+// No files are opened, no new revisions are created, and no file content is transferred. The Type option is
+// required. Retype requires admin access. If your path includes any reserved characters (@#%*), you need to
+// first escape your path with EscapePath.
+func (p *P4) Retype(paths []string, opts ...Option) error {
+	var args []string
+	for _, o := range opts {
+		switch ot := o.(type) {
+		case oType:
+			if len(ot.Type) > 0 {
+				args = append(args, fmt.Sprintf(`-t %s`, ot.Type))
+			}
+		default:
+			return fmt.Errorf("unrecognized option %s", o.String())
+		}
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("retype requires the Type option")
+	}
+
+	// only change the head revision
+	revs := make([]string, len(paths))
+	for i, path := range paths {
+		revs[i] = path + "#head"
+	}
+
+	// write paths to disk to avoid command line character limit
+	fnCleanup, filename, err := WriteTempFile("p4harmonize_retype_*.txt", strings.Join(revs, "\n"))
+	if err != nil {
+		return err
+	}
+	defer fnCleanup()
+
+	return p.sh.Cmdf(`%s -x "%s" retype %s`, p.cmd(), filename, strings.Join(args, " ")).RunErr()
+}
@@ -5,6 +5,24 @@ import (
 	"strings"
 )
 
+// Revert reverts checked out files that match the given path. With the Keep option, the local files are left as-is.
+func (p *P4) Revert(path string, opts ...Option) error {
+	var args []string
+	for _, o := range opts {
+		switch ot := o.(type) {
+		case oChangelist:
+			if ot.CL > 0 {
+				args = append(args, fmt.Sprintf("-c %d", ot.CL))
+			}
+		case oKeep:
+			args = append(args, "-k")
+		default:
+			return fmt.Errorf("unrecognized option %s", o.String())
+		}
+	}
+	return p.sh.Cmdf(`%s revert %s "%s"`, p.cmd(), strings.Join(args, " "), path).RunErr()
+}
+
 // RevertUnchanged reverts checked out files that have not been changed.
 func (p *P4) RevertUnchanged(path string, opts ...Option) error {
 	var args []string
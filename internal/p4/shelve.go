@@ -0,0 +1,35 @@
+package p4
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Shelve shelves every file open in the given changelist, replacing any files already shelved there.
+// The files stay open in the client; see Revert with the Keep option to revert them without touching
+// the local files.
+func (p *P4) Shelve(cl int64) error {
+	return p.sh.Cmdf(`%s shelve -f -c %d`, p.cmd(), cl).RunErr()
+}
+
+// Unshelve opens the files shelved in the given changelist in the current client, in the changelist
+// given by the Changelist option (or the default changelist, if none is given).
+func (p *P4) Unshelve(cl int64, opts ...Option) error {
+	var args []string
+	for _, o := range opts {
+		switch ot := o.(type) {
+		case oChangelist:
+			if ot.CL > 0 {
+				args = append(args, fmt.Sprintf("-c %d", ot.CL))
+			}
+		default:
+			return fmt.Errorf("unrecognized option %s", o.String())
+		}
+	}
+	return p.sh.Cmdf(`%s unshelve -s %d %s`, p.cmd(), cl, strings.Join(args, " ")).RunErr()
+}
+
+// DeleteShelf deletes every file shelved in the given changelist.
+func (p *P4) DeleteShelf(cl int64) error {
+	return p.sh.Cmdf(`%s shelve -d -c %d`, p.cmd(), cl).RunErr()
+}
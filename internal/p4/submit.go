@@ -1,6 +1,35 @@
 package p4
 
-// SubmitChangelist submits the given changelist
-func (p *P4) SubmitChangelist(cl int64) error {
-	return p.sh.Cmdf(`%s submit -c %d`, p.cmd(), cl).RunErr()
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SubmitChangelist submits the given changelist, and returns the number of the submitted change, which
+// the server may have renumbered from the pending changelist's number.
+func (p *P4) SubmitChangelist(cl int64) (int64, error) {
+	var submitted int64
+	err := p.cmdAndScan(
+		fmt.Sprintf(`%s -ztag submit -c %d`, p.cmd(), cl),
+		func(line string) error {
+			raw, found := strings.CutPrefix(strings.TrimSpace(line), "... submittedChange ")
+			if !found {
+				return nil
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				return fmt.Errorf("unable to parse changelist number from '%s': %v", raw, err)
+			}
+			submitted = n
+			return nil
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if submitted == 0 {
+		return 0, fmt.Errorf("no submitted change was reported for changelist %d", cl)
+	}
+	return submitted, nil
 }
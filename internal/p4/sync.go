@@ -1,12 +1,21 @@
 package p4
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // SyncLatest runs p4 sync ...#head
 func (p *P4) SyncLatest() error {
-	err := p.sh.Cmdf(`%s sync //%s/...#head`, p.cmd(), p.Client).RunErr()
+	return p.SyncTo("#head")
+}
+
+// SyncTo runs p4 sync ...<revision>, where revision is a revision specifier, for example
+// "#head", "@12345", "@some_label", or "@2024/05/01".
+func (p *P4) SyncTo(revision string) error {
+	err := p.sh.Cmdf(`%s sync "//%s/...%s"`, p.cmd(), p.Client, revision).RunErr()
 	if err != nil {
-		return fmt.Errorf("error syncing %s to head: %w", p.Client, err)
+		return fmt.Errorf("error syncing %s to %s: %w", p.Client, revision, err)
 	}
 	return nil
 }
@@ -20,3 +29,68 @@ func (p *P4) SyncLatestNoDownload() error {
 	}
 	return nil
 }
+
+// SyncFiles runs p4 sync on just the passed paths, which may include a revision specifier, for
+// example "//client/some/file.txt#head" or "//client/other/file.txt@12345". With the Force option,
+// files are downloaded again even if the client already has that revision.
+func (p *P4) SyncFiles(paths []string, opts ...Option) error {
+	var args []string
+	for _, o := range opts {
+		switch o.(type) {
+		case oForce:
+			args = append(args, "-f")
+		default:
+			return fmt.Errorf("unrecognized option %s", o.String())
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	// write paths to disk to avoid command line character limit
+	fnCleanup, filename, err := WriteTempFile("p4harmonize_sync_*.txt", strings.Join(paths, "\n"))
+	if err != nil {
+		return err
+	}
+	defer fnCleanup()
+
+	err = p.sh.Cmdf(`%s -x "%s" sync %s`, p.cmd(), filename, strings.Join(args, " ")).RunErr()
+	if err != nil {
+		return fmt.Errorf("error syncing %d file(s) in %s: %w", len(paths), p.Client, err)
+	}
+	return nil
+}
+
+// ChangedInWorkspace returns the depot paths of any of the passed files whose local copy has been changed
+// or deleted, without being opened, since the file was last synced ("p4 diff -se" and "p4 diff -sd").
+// Files that are open in the client are not checked.
+func (p *P4) ChangedInWorkspace(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	// write paths to disk to avoid command line character limit
+	fnCleanup, filename, err := WriteTempFile("p4harmonize_diff_*.txt", strings.Join(paths, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	defer fnCleanup()
+
+	var out []string
+	for _, flag := range []string{"-se", "-sd"} {
+		err := p.cmdAndScan(
+			fmt.Sprintf(`%s -x "%s" -F %%depotFile%% diff %s`, p.cmd(), filename, flag),
+			func(line string) error {
+				if path := strings.TrimSpace(line); len(path) > 0 {
+					out = append(out, path)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error checking for changed files in %s: %w", p.Client, err)
+		}
+	}
+	return out, nil
+}
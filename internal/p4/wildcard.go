@@ -0,0 +1,37 @@
+package p4
+
+import (
+	"regexp"
+	"strings"
+)
+
+// WildcardRegexp converts a path pattern that uses perforce wildcards into a regular expression that
+// matches an entire path, ignoring case. "..." matches any characters (including "/"), and "*" matches
+// any characters except "/". All other characters match themselves.
+func WildcardRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.Grow(len(pattern) + 16)
+	sb.WriteString("(?i)^")
+
+	for i := 0; i < len(pattern); {
+		switch {
+		case strings.HasPrefix(pattern[i:], "..."):
+			sb.WriteString(".*")
+			i += 3
+		case pattern[i] == '*':
+			sb.WriteString("[^/]*")
+			i++
+		default:
+			j := i + 1
+			for j < len(pattern) && pattern[j] != '*' && !strings.HasPrefix(pattern[j:], "...") {
+				j++
+			}
+			sb.WriteString(regexp.QuoteMeta(pattern[i:j]))
+			i = j
+		}
+	}
+
+	sb.WriteString("$")
+	// all non-wildcard characters were quoted, so this can't fail to compile
+	return regexp.MustCompile(sb.String())
+}
@@ -0,0 +1,36 @@
+package p4
+
+import (
+	"testing"
+)
+
+func Test_WildcardRegexp(t *testing.T) {
+	var cases = []struct {
+		Pattern  string
+		Path     string
+		Expected bool
+	}{
+		{"Engine/...", "Engine/Source/Runtime/foo.cpp", true},
+		{"Engine/...", "engine/build.cs", true},
+		{"Engine/...", "Engine", false},
+		{"Engine/...", "Samples/Engine/foo", false},
+		{"*.uasset", "chair.uasset", true},
+		{"*.uasset", "Engine/chair.uasset", false},
+		{".../*.uasset", "Engine/Content/chair.uasset", true},
+		{"...uasset", "Engine/Content/chair.uasset", true},
+		{"Engine/*/Build.cs", "Engine/Source/Build.cs", true},
+		{"Engine/*/Build.cs", "Engine/Source/Runtime/Build.cs", false},
+		{"Icon20@2x.png", "Icon20@2x.png", true},
+		{"a+b(c).txt", "a+b(c).txt", true},
+		{"a.txt", "abtxt", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Pattern+" "+tc.Path, func(t *testing.T) {
+			actual := WildcardRegexp(tc.Pattern).MatchString(tc.Path)
+			if actual != tc.Expected {
+				t.Errorf("Expected '%s' matching '%s' to be %v", tc.Pattern, tc.Path, tc.Expected)
+			}
+		})
+	}
+}